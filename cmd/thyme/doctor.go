@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/sourcegraph/thyme"
+)
+
+// DoctorCmd is the subcommand that diagnoses problems with the
+// environment Thyme runs in.
+type DoctorCmd struct {
+	File    string        `long:"file" short:"f" description:"data file to check (the file passed to track -o or show -i)"`
+	Store   string        `long:"store" description:"storage backend for the data file {jsonl,json,bolt}" default:"jsonl"`
+	Timeout time.Duration `long:"timeout" description:"time after which to give up on the trial snapshot (0 to wait forever)" default:"10s"`
+}
+
+var doctorCmd DoctorCmd
+
+// doctorEnv lists the environment variables that determine which
+// tracker can run.
+var doctorEnv = []string{
+	"DISPLAY",
+	"WAYLAND_DISPLAY",
+	"XDG_SESSION_TYPE",
+	"XDG_CURRENT_DESKTOP",
+	"SWAYSOCK",
+	"I3SOCK",
+	"HYPRLAND_INSTANCE_SIGNATURE",
+	"DBUS_SESSION_BUS_ADDRESS",
+}
+
+// report collects the findings of DoctorCmd and writes them to out.
+type report struct {
+	out      io.Writer
+	failures int
+}
+
+func (r *report) section(title string) {
+	fmt.Fprintf(r.out, "\n%s\n", title)
+}
+
+func (r *report) ok(format string, args ...interface{}) {
+	fmt.Fprintf(r.out, "  [ok]   %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *report) info(format string, args ...interface{}) {
+	fmt.Fprintf(r.out, "  [info] %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *report) warn(format string, args ...interface{}) {
+	fmt.Fprintf(r.out, "  [warn] %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *report) fail(format string, args ...interface{}) {
+	r.failures++
+	fmt.Fprintf(r.out, "  [FAIL] %s\n", fmt.Sprintf(format, args...))
+}
+
+// fix prints a suggestion for addressing the previous finding.
+func (r *report) fix(format string, args ...interface{}) {
+	fmt.Fprintf(r.out, "         -> %s\n", fmt.Sprintf(format, args...))
+}
+
+func (c *DoctorCmd) Execute(args []string) error {
+	return c.run(os.Stdout)
+}
+
+// run writes the report to out and returns an error if it found any
+// problems.
+func (c *DoctorCmd) run(out io.Writer) error {
+	r := report{out: out}
+
+	r.section("Environment")
+	r.info("OS: %s/%s", runtime.GOOS, runtime.GOARCH)
+	for _, name := range doctorEnv {
+		if val, ok := os.LookupEnv(name); ok {
+			r.info("%s=%s", name, val)
+		} else {
+			r.info("%s is not set", name)
+		}
+	}
+
+	r.section("Trackers")
+	detected, detectErr := thyme.DetectTracker()
+	for _, name := range thyme.Trackers() {
+		if err := thyme.ProbeTracker(name); err != nil {
+			r.info("%s: unavailable: %s", name, err)
+		} else {
+			r.ok("%s: available", name)
+		}
+	}
+	name := globalOpts.Tracker
+	if name != "" {
+		r.info("using %s (from --tracker)", name)
+	} else if detectErr != nil {
+		r.fail("no tracker detected: %s", detectErr)
+		r.fix("choose a tracker with --tracker")
+	} else {
+		name = detected
+		r.info("using %s (detected)", name)
+	}
+
+	if name != "" {
+		c.checkTracker(&r, name)
+	}
+	if c.File != "" {
+		c.checkFile(&r)
+	}
+
+	fmt.Fprintln(out)
+	if r.failures > 0 {
+		return fmt.Errorf("found %d problems", r.failures)
+	}
+	fmt.Fprintln(out, "No problems found.")
+	return nil
+}
+
+// checkTracker checks the dependencies of the tracker `name` and
+// takes a trial snapshot with it.
+func (c *DoctorCmd) checkTracker(r *report, name string) {
+	r.section(fmt.Sprintf("Tracker %q", name))
+	t, err := thyme.NewTracker(name)
+	if err != nil {
+		r.fail("%s", err)
+		r.fix("run `thyme trackers` to list the available trackers")
+		return
+	}
+	if checker, ok := t.(thyme.DepChecker); ok {
+		for _, dep := range checker.CheckDeps() {
+			switch {
+			case dep.Found:
+				r.ok("dependency %s: %s", dep.Name, dep.Detail)
+			case dep.Optional:
+				r.warn("optional dependency %s is missing: %s", dep.Name, dep.Detail)
+				r.fix("run `thyme dep --check` for install instructions")
+			default:
+				r.fail("dependency %s is missing: %s", dep.Name, dep.Detail)
+				r.fix("run `thyme dep --check` for install instructions")
+			}
+		}
+	}
+	caps := t.Capabilities()
+	r.info("capabilities: %+v", caps)
+
+	start := time.Now()
+	snap, err := takeSnapshot(context.Background(), t, c.Timeout)
+	elapsed := time.Since(start)
+	if err != nil {
+		r.fail("trial snapshot failed after %s: %s", elapsed, err)
+		return
+	}
+	r.ok("trial snapshot took %s: %d windows, %d visible", elapsed, len(snap.Windows), len(snap.Visible))
+	if snap.Active == 0 {
+		r.warn("no active window was reported")
+	}
+	if len(snap.Windows) == 0 {
+		r.warn("no windows were reported")
+		r.fix("check that the tracker matches your windowing system (see `thyme trackers`)")
+	}
+}
+
+// checkFile checks that the data file can be written and that its
+// existing contents are valid.
+func (c *DoctorCmd) checkFile(r *report) {
+	r.section(fmt.Sprintf("Data file %q", c.File))
+
+	fi, err := os.Stat(c.File)
+	switch {
+	case os.IsNotExist(err):
+		r.info("file does not exist yet")
+		dir := filepath.Dir(c.File)
+		if f, err := ioutil.TempFile(dir, ".thyme-doctor"); err != nil {
+			r.fail("cannot create files in %s: %s", dir, err)
+			r.fix("choose a different output file or fix the directory's permissions")
+		} else {
+			f.Close()
+			os.Remove(f.Name())
+			r.ok("directory %s is writable", dir)
+		}
+		return
+	case err != nil:
+		r.fail("%s", err)
+		return
+	}
+
+	r.info("size: %d bytes, last modified %s", fi.Size(), fi.ModTime().Format(time.RFC3339))
+	if f, err := os.OpenFile(c.File, os.O_WRONLY|os.O_APPEND, 0); err != nil {
+		r.fail("file is not writable: %s", err)
+		r.fix("fix the file's permissions (e.g., chmod u+w %s)", c.File)
+	} else {
+		f.Close()
+		r.ok("file is writable")
+	}
+
+	if c.Store == "json" || c.Store == "jsonl" {
+		f, err := os.Open(c.File)
+		if err != nil {
+			r.fail("%s", err)
+			return
+		}
+		defer f.Close()
+		stream, format, err := thyme.InspectStream(f)
+		if err != nil {
+			r.fail("file is not a valid stream: %s", err)
+			r.fix("check whether the file was written with a different --store")
+			return
+		}
+		r.ok("format: %s", format)
+		if format == thyme.FormatLegacy || format == thyme.FormatMixed {
+			r.warn("legacy format is slow to read and write")
+			r.fix("run `thyme migrate -i %s`", c.File)
+		}
+		c.checkStream(r, stream)
+		return
+	}
+
+	store, err := thyme.OpenStore(c.Store, c.File)
+	if err != nil {
+		r.fail("%s", err)
+		return
+	}
+	defer store.Close()
+	stream, err := store.Range(time.Time{}, time.Time{})
+	if err != nil {
+		r.fail("could not read data with store %s: %s", c.Store, err)
+		r.fix("check whether the file was written with a different --store")
+		return
+	}
+	r.ok("format: %s", c.Store)
+	c.checkStream(r, stream)
+}
+
+// checkStream reports on the contents of a stream.
+func (c *DoctorCmd) checkStream(r *report, stream *thyme.Stream) {
+	if len(stream.Snapshots) == 0 {
+		r.info("no snapshots recorded yet")
+		return
+	}
+	first, last := stream.Snapshots[0], stream.Snapshots[len(stream.Snapshots)-1]
+	r.ok("%d snapshots from %s to %s", len(stream.Snapshots), first.Time.Format(time.RFC3339), last.Time.Format(time.RFC3339))
+	if stream.Capabilities == nil {
+		r.info("the data was recorded by an older version of Thyme, which didn't record the tracker's capabilities")
+	} else {
+		r.info("capabilities of the trackers that recorded the data: %+v", *stream.Capabilities)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/thyme"
+)
+
+// depsTracker is a fakeTracker that reports the dependencies in deps.
+type depsTracker struct {
+	fakeTracker
+	deps []*thyme.Dependency
+}
+
+func (t *depsTracker) CheckDeps() []*thyme.Dependency {
+	return t.deps
+}
+
+// doctorDeps are the dependencies reported by the "doctor-test"
+// tracker.
+var doctorDeps []*thyme.Dependency
+
+func init() {
+	thyme.RegisterTracker("doctor-test", func() thyme.Tracker {
+		return &depsTracker{deps: doctorDeps}
+	})
+}
+
+func TestDoctor(t *testing.T) {
+	// Keep the other trackers' probes from finding a windowing
+	// system.
+	for _, name := range []string{"DISPLAY", "WAYLAND_DISPLAY", "XDG_SESSION_TYPE", "XDG_CURRENT_DESKTOP", "SWAYSOCK", "I3SOCK", "HYPRLAND_INSTANCE_SIGNATURE"} {
+		t.Setenv(name, "")
+	}
+	defer func(tracker string) { globalOpts.Tracker = tracker }(globalOpts.Tracker)
+	globalOpts.Tracker = "doctor-test"
+
+	dir, err := ioutil.TempDir("", "thyme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	legacy := filepath.Join(dir, "legacy.json")
+	if err := ioutil.WriteFile(legacy, []byte(`{"Snapshots": [{"Time": "2016-01-02T15:04:05Z", "Active": 1}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	text := filepath.Join(dir, "notes.txt")
+	if err := ioutil.WriteFile(text, []byte("not a stream\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	xdotool := &thyme.Dependency{Name: "xdotool", Found: true, Detail: "/usr/bin/xdotool"}
+	xprintidle := &thyme.Dependency{Name: "xprintidle", Detail: "not found in PATH", Optional: true}
+	wmctrl := &thyme.Dependency{Name: "wmctrl", Detail: "not found in PATH"}
+	tests := []struct {
+		name     string
+		deps     []*thyme.Dependency
+		file     string
+		wantErr  bool
+		findings []string
+	}{{
+		name: "all dependencies",
+		deps: []*thyme.Dependency{xdotool},
+		file: legacy,
+		findings: []string{
+			"[ok]   dependency xdotool: /usr/bin/xdotool",
+			"[ok]   trial snapshot took",
+			"[ok]   format: legacy JSON (schema version 1)",
+			"[warn] legacy format is slow to read and write\n         -> run `thyme migrate -i " + legacy + "`",
+			"[ok]   1 snapshots from 2016-01-02T15:04:05Z to 2016-01-02T15:04:05Z",
+			"No problems found.",
+		},
+	}, {
+		name: "optional dependency missing",
+		deps: []*thyme.Dependency{xdotool, xprintidle},
+		findings: []string{
+			"[warn] optional dependency xprintidle is missing: not found in PATH\n         -> run `thyme dep --check` for install instructions",
+			"No problems found.",
+		},
+	}, {
+		name:    "required dependency missing",
+		deps:    []*thyme.Dependency{xdotool, wmctrl, xprintidle},
+		file:    filepath.Join(dir, "new.jsonl"),
+		wantErr: true,
+		findings: []string{
+			"[FAIL] dependency wmctrl is missing: not found in PATH\n         -> run `thyme dep --check` for install instructions",
+			"[info] file does not exist yet",
+			"[ok]   directory " + dir + " is writable",
+		},
+	}, {
+		name:    "invalid data file",
+		deps:    []*thyme.Dependency{xdotool},
+		file:    text,
+		wantErr: true,
+		findings: []string{
+			"[FAIL] file is not a valid stream",
+		},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doctorDeps = test.deps
+			c := DoctorCmd{File: test.file, Store: "jsonl"}
+			var out bytes.Buffer
+			err := c.run(&out)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+			for _, finding := range test.findings {
+				if !strings.Contains(out.String(), finding) {
+					t.Errorf("report doesn't contain %q:\n%s", finding, out.String())
+				}
+			}
+		})
+	}
+}
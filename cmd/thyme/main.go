@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"runtime"
+	"os/signal"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/sourcegraph/thyme"
@@ -13,6 +20,13 @@ import (
 
 var CLI = flags.NewNamedParser("thyme", flags.PrintErrors|flags.PassDoubleDash)
 
+// GlobalOpts are the options that apply to every subcommand.
+type GlobalOpts struct {
+	Tracker string `long:"tracker" short:"t" description:"tracker to use (see thyme trackers); detected from the environment by default"`
+}
+
+var globalOpts GlobalOpts
+
 func init() {
 	CLI.Usage = `
 thyme - automatically track which applications you use and for how long.
@@ -27,25 +41,46 @@ thyme - automatically track which applications you use and for how long.
 Example usage:
 
   thyme dep
+  thyme trackers
+  thyme doctor -f <file>
   thyme track -o <file>
+  thyme daemon -o <file> -n 30s
   thyme show  -i <file> -w stats > viz.html
+  thyme migrate -i <file>
 
 `
 
-	if _, err := CLI.AddCommand("track", "record current windows", "Record current window metadata as JSON printed to stdout or a file. If a filename is specified and the file already exists, Thyme will append the new snapshot data to the existing data.", &trackCmd); err != nil {
+	if _, err := CLI.AddGroup("Global Options", "", &globalOpts); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := CLI.AddCommand("track", "record current windows", "Record current window metadata as JSON printed to stdout or a file. If a filename is specified, Thyme will append the new snapshot to it as a single line of JSON.", &trackCmd); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := CLI.AddCommand("daemon", "record windows periodically", "Run in the foreground, recording current window metadata on a fixed interval and appending it to a file, until interrupted (SIGINT or SIGTERM).", &daemonCmd); err != nil {
 		log.Fatal(err)
 	}
 	if _, err := CLI.AddCommand("show", "visualize data", "Generate an HTML page visualizing the data from a file written to by `thyme track`.", &showCmd); err != nil {
 		log.Fatal(err)
 	}
-	if _, err := CLI.AddCommand("dep", "dep install instructions", "Show installation instructions for required external dependencies (which vary depending on your OS and windowing system).", &depCmd); err != nil {
+	if _, err := CLI.AddCommand("migrate", "convert data to the current format", "Convert a file written by older versions of `thyme track` (a single JSON object) to the current format (one JSON snapshot per line), which can be appended to without rewriting the file.", &migrateCmd); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := CLI.AddCommand("trackers", "list trackers", "List the trackers Thyme supports, whether each one can run in the current environment, and which one is used by default.", &trackersCmd); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := CLI.AddCommand("doctor", "diagnose problems", "Check the environment, the available trackers, and (with --file) the data file for problems, and print a report that suggests how to fix them.", &doctorCmd); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := CLI.AddCommand("dep", "dep install instructions", "Show installation instructions for required external dependencies (which vary depending on your OS and windowing system). With --check, check which dependencies are installed instead, and exit with a non-zero status if any are missing.", &depCmd); err != nil {
 		log.Fatal(err)
 	}
 }
 
 // TrackCmd is the subcommand that tracks application usage.
 type TrackCmd struct {
-	Out string `long:"out" short:"o" description:"output file"`
+	Out     string        `long:"out" short:"o" description:"output file"`
+	Store   string        `long:"store" description:"storage backend for the output file {jsonl,json,bolt}" default:"jsonl"`
+	Timeout time.Duration `long:"timeout" description:"time after which to give up on the snapshot (0 to wait forever)" default:"10s"`
 }
 
 var trackCmd TrackCmd
@@ -55,9 +90,14 @@ func (c *TrackCmd) Execute(args []string) error {
 	if err != nil {
 		return err
 	}
-	snap, err := t.Snap()
-	if err != nil {
-		return err
+	snap, snapErr := takeSnapshot(context.Background(), t, c.Timeout)
+	if snapErr != nil {
+		if c.Out == "" {
+			return snapErr
+		}
+		// Record the failed sample as a gap so that reports can tell
+		// missing data apart from time when nothing was open.
+		snap = thyme.NewGap(time.Now(), snapErr)
 	}
 
 	if c.Out == "" {
@@ -66,43 +106,141 @@ func (c *TrackCmd) Execute(args []string) error {
 			return err
 		}
 		fmt.Println(string(out))
-	} else {
-		var stream thyme.Stream
-		if _, err := os.Stat(c.Out); err == nil {
-			if err := func() error {
-				f, err := os.Open(c.Out)
-				if err != nil {
-					return err
-				}
-				defer f.Close()
-				if err := json.NewDecoder(f).Decode(&stream); err != nil {
-					return err
-				}
-				return nil
-			}(); err != nil {
+		return nil
+	}
+
+	store, err := thyme.OpenStore(c.Store, c.Out)
+	if err != nil {
+		return err
+	}
+	if err := store.SetCapabilities(t.Capabilities()); err != nil {
+		store.Close()
+		return err
+	}
+	if err := store.Append(snap); err != nil {
+		store.Close()
+		return err
+	}
+	if err := store.Close(); err != nil {
+		return err
+	}
+	return snapErr
+}
+
+// DaemonCmd is the subcommand that tracks application usage
+// continuously, taking a snapshot every interval with a single
+// long-lived Tracker.
+type DaemonCmd struct {
+	Out      string        `long:"out" short:"o" description:"output file" required:"true"`
+	Interval time.Duration `long:"interval" short:"n" description:"time between snapshots" default:"30s"`
+	Store    string        `long:"store" description:"storage backend for the output file {jsonl,json,bolt}" default:"jsonl"`
+	Timeout  time.Duration `long:"timeout" description:"time after which to give up on a snapshot and record a gap (0 to wait forever)" default:"10s"`
+}
+
+var daemonCmd DaemonCmd
+
+func (c *DaemonCmd) Execute(args []string) error {
+	if c.Interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", c.Interval)
+	}
+	t, err := getTracker()
+	if err != nil {
+		return err
+	}
+	store, err := thyme.OpenStore(c.Store, c.Out)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := store.SetCapabilities(t.Capabilities()); err != nil {
+		return err
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	return runDaemon(t, c.Interval, c.Timeout, sig, store.Append)
+}
+
+// runDaemon takes a snapshot with t right away and then every
+// interval, passing each one to write, until it receives a signal on
+// stop. A snapshot that takes longer than timeout is given up on and
+// recorded as a gap. The signal also cancels the snapshot in
+// progress, if any, after which runDaemon writes a gap marker, so
+// that the time until the daemon runs again isn't attributed to the
+// last active window, and returns.
+func runDaemon(t thyme.Tracker, interval, timeout time.Duration, stop <-chan os.Signal, write func(*thyme.Snapshot) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case s := <-stop:
+			log.Printf("received %s, shutting down", s)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Samples are taken and written synchronously on this goroutine,
+	// so a signal only ever cancels a snapshot, never a write.
+	var last time.Time
+	record := func() error {
+		// Ticks are dropped while the machine is suspended, and the
+		// monotonic clock may not advance then, so missed samples
+		// are found by comparing wall clock times. They are recorded
+		// as a gap rather than as more of the last snapshot.
+		if now := time.Now().Round(0); !last.IsZero() && now.Sub(last) > 2*interval {
+			missed := fmt.Errorf("no samples were taken between %s and %s", last.Format(time.RFC3339), now.Format(time.RFC3339))
+			log.Print(missed)
+			if err := write(thyme.NewGap(last.Add(interval), missed)); err != nil {
 				return err
 			}
-		} else if !os.IsNotExist(err) {
-			return err
 		}
-		stream.Snapshots = append(stream.Snapshots, snap)
-		f, err := os.Create(c.Out)
+
+		snap, err := takeSnapshot(ctx, t, timeout)
+		last = time.Now().Round(0)
 		if err != nil {
-			return err
+			if ctx.Err() != nil {
+				// The daemon is shutting down; the gap marker
+				// written then covers this sample.
+				return nil
+			}
+			// A single failed sample shouldn't bring down the
+			// daemon; record it as a gap and try again on the next
+			// tick.
+			log.Printf("snapshot failed: %s", err)
+			snap = thyme.NewGap(time.Now(), err)
 		}
-		if err := json.NewEncoder(f).Encode(stream); err != nil {
+		return write(snap)
+	}
+	for ctx.Err() == nil {
+		if err := record(); err != nil {
 			return err
 		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
 	}
-
-	return nil
+	return write(thyme.NewGap(time.Now(), errDaemonStopped))
 }
 
+// errDaemonStopped is the reason recorded in the gap marker the
+// daemon writes when it shuts down.
+var errDaemonStopped = errors.New("thyme daemon stopped")
+
 // ShowCmd is the subcommand that reads the data emitted by the track
 // subcommand and displays the data to the user.
 type ShowCmd struct {
-	In   string `long:"in" short:"i" description:"input file"`
-	What string `long:"what" short:"w" description:"what to show {list,stats}" default:"list"`
+	In    string `long:"in" short:"i" description:"input file"`
+	What  string `long:"what" short:"w" description:"what to show {list,stats,workspaces}" default:"list"`
+	Store string `long:"store" description:"storage backend for the input file {jsonl,json,bolt}" default:"jsonl"`
+
+	IdleThreshold time.Duration `long:"idle-threshold" description:"idle time after which the user is considered away (0 to disable)" default:"5m"`
 }
 
 var showCmd ShowCmd
@@ -117,31 +255,102 @@ func (c *ShowCmd) Execute(args []string) error {
 			fmt.Printf("%+v\n", w.Info())
 		}
 	} else {
-		var stream thyme.Stream
-		f, err := os.Open(c.In)
+		store, err := thyme.OpenStore(c.Store, c.In)
 		if err != nil {
 			return err
 		}
-		defer f.Close()
-
-		if err := json.NewDecoder(f).Decode(&stream); err != nil {
+		defer store.Close()
+		stream, err := store.Range(time.Time{}, time.Time{})
+		if err != nil {
 			return err
 		}
 		switch c.What {
 		case "stats":
-			if err := thyme.Stats(&stream); err != nil {
+			if err := thyme.Stats(stream, c.IdleThreshold); err != nil {
+				return err
+			}
+		case "workspaces":
+			if err := thyme.Workspaces(stream, c.IdleThreshold); err != nil {
 				return err
 			}
 		case "list":
 			fallthrough
 		default:
-			thyme.List(&stream)
+			thyme.List(stream)
 		}
 	}
 	return nil
 }
 
-type DepCmd struct{}
+// MigrateCmd is the subcommand that converts a file written in the
+// legacy single-object format to the JSON Lines format.
+type MigrateCmd struct {
+	In  string `long:"in" short:"i" description:"input file" required:"true"`
+	Out string `long:"out" short:"o" description:"output file (defaults to converting the input file in place)"`
+}
+
+var migrateCmd MigrateCmd
+
+func (c *MigrateCmd) Execute(args []string) error {
+	out := c.Out
+	if out == "" {
+		out = c.In
+	}
+
+	// Hold the locks while converting so that snapshots appended by a
+	// concurrent tracker aren't lost when the output is replaced.
+	lock, err := thyme.LockFile(c.In)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if out != c.In {
+		outLock, err := thyme.LockFile(out)
+		if err != nil {
+			return err
+		}
+		defer outLock.Unlock()
+	}
+
+	stream, err := readStream(c.In)
+	if err != nil {
+		return err
+	}
+	return thyme.WriteFileAtomic(out, func(w io.Writer) error {
+		return thyme.EncodeStream(w, stream)
+	})
+}
+
+// takeSnapshot takes a snapshot with t, giving up once ctx is done or
+// timeout has passed. A timeout of zero waits until ctx is done.
+func takeSnapshot(ctx context.Context, t thyme.Tracker, timeout time.Duration) (*thyme.Snapshot, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	snap, err := t.Snap(ctx)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("snapshot timed out after %s", timeout)
+	}
+	return snap, err
+}
+
+// readStream reads the stream stored in the file named in.
+func readStream(in string) (*thyme.Stream, error) {
+	f, err := os.Open(in)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return thyme.DecodeStream(f)
+}
+
+// DepCmd is the subcommand that shows or checks the external
+// dependencies of the tracker.
+type DepCmd struct {
+	Check bool `long:"check" short:"c" description:"check whether the dependencies are installed, exiting with a non-zero status if any are missing"`
+}
 
 var depCmd DepCmd
 
@@ -150,7 +359,87 @@ func (c *DepCmd) Execute(args []string) error {
 	if err != nil {
 		return err
 	}
-	fmt.Println(t.Deps())
+	if !c.Check {
+		fmt.Println(t.Deps())
+		return nil
+	}
+
+	checker, ok := t.(thyme.DepChecker)
+	if !ok {
+		fmt.Println(t.Deps())
+		return fmt.Errorf("this tracker can't check its dependencies automatically; follow the instructions above")
+	}
+	return printDeps(os.Stdout, checker.CheckDeps())
+}
+
+// printDeps writes a table of the results of checking deps to out,
+// followed by install instructions for those that are missing. It
+// returns an error if any required dependencies are missing.
+func printDeps(out io.Writer, deps []*thyme.Dependency) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "DEPENDENCY\tSTATUS\tDETAIL\n")
+	var missing []*thyme.Dependency
+	for _, dep := range deps {
+		status := "ok"
+		if !dep.Found {
+			if dep.Optional {
+				status = "missing (optional)"
+			} else {
+				status = "MISSING"
+			}
+			missing = append(missing, dep)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", dep.Name, status, dep.Detail)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	var required int
+	for i, dep := range missing {
+		if i == 0 {
+			fmt.Fprintf(out, "\nTo install the missing dependencies:\n")
+		}
+		if !dep.Optional {
+			required++
+		}
+		fmt.Fprintf(out, "* %s\n", dep.Name)
+		distros := make([]string, 0, len(dep.Install))
+		for distro := range dep.Install {
+			distros = append(distros, distro)
+		}
+		sort.Strings(distros)
+		for _, distro := range distros {
+			fmt.Fprintf(out, "    %s: %s\n", distro, dep.Install[distro])
+		}
+	}
+	if required > 0 {
+		return fmt.Errorf("%d required dependencies are missing", required)
+	}
+	return nil
+}
+
+// TrackersCmd is the subcommand that lists the available trackers.
+type TrackersCmd struct{}
+
+var trackersCmd TrackersCmd
+
+func (c *TrackersCmd) Execute(args []string) error {
+	detected, _ := thyme.DetectTracker()
+	for _, name := range thyme.Trackers() {
+		mark := " "
+		if name == detected {
+			mark = "*"
+		}
+		status := "available"
+		if err := thyme.ProbeTracker(name); err != nil {
+			status = "unavailable: " + err.Error()
+		}
+		fmt.Printf("%s %-10s %s\n", mark, name, status)
+	}
+	if detected != "" {
+		fmt.Printf("\n* used by default (override with --tracker)\n")
+	}
 	return nil
 }
 
@@ -174,13 +463,21 @@ func main() {
 	}
 }
 
+// getTracker returns the Tracker selected by the --tracker option,
+// or the one best suited to the current environment if the option
+// isn't set.
 func getTracker() (thyme.Tracker, error) {
-	switch runtime.GOOS {
-	case "windows":
-		return thyme.NewTracker("windows"), nil
-	case "darwin":
-		return thyme.NewTracker("darwin"), nil
-	default:
-		return thyme.NewTracker("linux"), nil
+	name := globalOpts.Tracker
+	if name == "" {
+		detected, err := thyme.DetectTracker()
+		if err != nil {
+			return nil, fmt.Errorf("%s. Use --tracker to choose one (see `thyme trackers`).", err)
+		}
+		name = detected
+	}
+	t, err := thyme.NewTracker(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s. Run `thyme trackers` to list the available trackers.", err)
 	}
+	return t, nil
 }
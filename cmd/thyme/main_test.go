@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/thyme"
+)
+
+// fakeTracker returns snapshots numbered by their Active window,
+// failing the calls listed in fail. The calls listed in block don't
+// return until their context is done.
+type fakeTracker struct {
+	calls int
+	fail  map[int]bool
+	block map[int]bool
+}
+
+func (t *fakeTracker) Snap(ctx context.Context) (*thyme.Snapshot, error) {
+	t.calls++
+	if t.block[t.calls] {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if t.fail[t.calls] {
+		return nil, errors.New("window disappeared")
+	}
+	return &thyme.Snapshot{Time: time.Now(), Active: int64(t.calls)}, nil
+}
+
+func (t *fakeTracker) Deps() string { return "" }
+
+func (t *fakeTracker) Capabilities() thyme.Capabilities { return thyme.Capabilities{} }
+
+// daemonLabel describes a snapshot written by runDaemon: the number
+// of its Active window, or the reason for a gap marker.
+func daemonLabel(snap *thyme.Snapshot) string {
+	if snap.IsGap() {
+		return "gap: " + snap.Gap
+	}
+	return fmt.Sprint(snap.Active)
+}
+
+func TestRunDaemon(t *testing.T) {
+	// Without a timeout, only the signal can end the fourth
+	// snapshot.
+	tracker := &fakeTracker{fail: map[int]bool{2: true}, block: map[int]bool{4: true}}
+	stop := make(chan os.Signal, 1)
+	var written []string
+	done := make(chan error, 1)
+	go func() {
+		done <- runDaemon(tracker, 10*time.Millisecond, 0, stop, func(snap *thyme.Snapshot) error {
+			if strings.HasPrefix(snap.Gap, "no samples were taken") {
+				// A slow test machine can miss a tick, which
+				// TestRunDaemonMissedSamples covers.
+				return nil
+			}
+			written = append(written, daemonLabel(snap))
+			if len(written) == 3 {
+				stop <- os.Interrupt
+			}
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the signal didn't cancel the snapshot in progress")
+	}
+	// The failed sample is recorded as a gap, the canceled one isn't
+	// recorded at all, and the time after the signal is recorded as
+	// a gap.
+	if want := []string{"1", "gap: window disappeared", "3", "gap: thyme daemon stopped"}; !reflect.DeepEqual(written, want) {
+		t.Errorf("got snapshots %q, want %q", written, want)
+	}
+}
+
+func TestRunDaemonMissedSamples(t *testing.T) {
+	tracker := &fakeTracker{}
+	stop := make(chan os.Signal, 1)
+	var written []*thyme.Snapshot
+	err := runDaemon(tracker, 10*time.Millisecond, 0, stop, func(snap *thyme.Snapshot) error {
+		written = append(written, snap)
+		switch snap.Active {
+		case 1:
+			// As if the machine were suspended after the first
+			// sample.
+			time.Sleep(100 * time.Millisecond)
+		case 2:
+			stop <- os.Interrupt
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) < 3 || written[0].Active != 1 || !strings.HasPrefix(written[1].Gap, "no samples were taken") || written[2].Active != 2 {
+		var got []string
+		for _, snap := range written {
+			got = append(got, daemonLabel(snap))
+		}
+		t.Fatalf("got snapshots %q, want the missed samples recorded as a gap between 1 and 2", got)
+	}
+	// The gap starts when the next sample was due, so the first
+	// sample only accounts for one interval.
+	if d := written[1].Time.Sub(written[0].Time); d > 50*time.Millisecond {
+		t.Errorf("gap starts %s after the first sample, want about one interval", d)
+	}
+}
+
+func TestRunDaemonWriteError(t *testing.T) {
+	tracker := &fakeTracker{}
+	errFull := errors.New("disk full")
+	var writes int
+	err := runDaemon(tracker, time.Millisecond, 0, nil, func(*thyme.Snapshot) error {
+		writes++
+		if writes == 2 {
+			return errFull
+		}
+		return nil
+	})
+	if err != errFull {
+		t.Errorf("got error %v, want %v", err, errFull)
+	}
+	if tracker.calls != 2 {
+		t.Errorf("got %d snapshots, want 2", tracker.calls)
+	}
+}
+
+func TestTakeSnapshotTimeout(t *testing.T) {
+	tracker := &fakeTracker{block: map[int]bool{1: true}}
+	_, err := takeSnapshot(context.Background(), tracker, 10*time.Millisecond)
+	if want := "snapshot timed out after 10ms"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "thyme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	start := time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)
+	stream := &thyme.Stream{Snapshots: []*thyme.Snapshot{
+		{Time: start, Active: 1, Windows: []*thyme.Window{{ID: 1, Name: "one"}}, Visible: []int64{1}},
+		{Time: start.Add(30 * time.Second), Active: 2, Windows: []*thyme.Window{{ID: 2, Name: "two"}}, Visible: []int64{2}},
+	}}
+	legacy, err := json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := filepath.Join(dir, "thyme.json")
+	if err := ioutil.WriteFile(in, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, out := range []string{filepath.Join(dir, "thyme.jsonl"), ""} {
+		c := MigrateCmd{In: in, Out: out}
+		if err := c.Execute(nil); err != nil {
+			t.Fatal(err)
+		}
+		if out == "" {
+			out = in
+		}
+		data, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := bytes.Count(data, []byte("\n")); lines != len(stream.Snapshots) {
+			t.Errorf("%s: got %d lines, want one per snapshot", out, lines)
+		}
+		got, err := readStream(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, stream) {
+			t.Errorf("%s: migrate changed the stream:\ngot  %+v\nwant %+v", out, got, stream)
+		}
+	}
+}
+
+func TestPrintDeps(t *testing.T) {
+	xprintidle := &thyme.Dependency{Name: "xprintidle", Detail: "not found in PATH", Optional: true, Install: map[string]string{"debian": "apt-get install xprintidle"}}
+	wmctrl := &thyme.Dependency{Name: "wmctrl", Detail: "not found in PATH", Install: map[string]string{"debian": "apt-get install wmctrl", "arch": "pacman -S wmctrl"}}
+	xdotool := &thyme.Dependency{Name: "xdotool", Found: true, Detail: "/usr/bin/xdotool"}
+
+	var out bytes.Buffer
+	if err := printDeps(&out, []*thyme.Dependency{xdotool, xprintidle}); err != nil {
+		t.Errorf("got error %v with only optional dependencies missing", err)
+	}
+	for _, want := range []string{"missing (optional)", "debian: apt-get install xprintidle"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := printDeps(&out, []*thyme.Dependency{xdotool, wmctrl, xprintidle}); err == nil {
+		t.Error("got no error with a required dependency missing")
+	}
+	for _, want := range []string{"wmctrl      MISSING", "arch: pacman -S wmctrl\n    debian: apt-get install wmctrl"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Thyme GNOME Shell extension.
+//
+// On Wayland, GNOME Shell doesn't let other clients list its windows,
+// so this extension exports a D-Bus object on the session bus (at
+// /com/sourcegraph/Thyme on the org.gnome.Shell connection) that
+// Thyme's "gnome" tracker queries for each snapshot.
+
+import Gio from 'gi://Gio';
+import Meta from 'gi://Meta';
+import {Extension} from 'resource:///org/gnome/shell/extensions/extension.js';
+
+const IFACE = `
+<node>
+  <interface name="com.sourcegraph.Thyme">
+    <method name="Windows">
+      <arg type="s" direction="out" name="windows"/>
+    </method>
+  </interface>
+</node>`;
+
+function frameRect(w) {
+    const r = w.get_frame_rect();
+    return {x: r.x, y: r.y, width: r.width, height: r.height};
+}
+
+// GNOME 49 replaced get_maximized() with is_maximized().
+function isMaximized(w) {
+    if (w.is_maximized)
+        return w.is_maximized();
+    return w.get_maximized() === Meta.MaximizeFlags.BOTH;
+}
+
+export default class ThymeExtension extends Extension {
+    enable() {
+        this._dbus = Gio.DBusExportedObject.wrapJSObject(IFACE, this);
+        this._dbus.export(Gio.DBus.session, '/com/sourcegraph/Thyme');
+    }
+
+    disable() {
+        this._dbus.flush();
+        this._dbus.unexport();
+        this._dbus = null;
+    }
+
+    // Windows returns a JSON description of all normal windows and
+    // workspaces. See gnome.go in Thyme for the Go side.
+    Windows() {
+        const workspaceManager = global.workspace_manager;
+        const activeWorkspace = workspaceManager.get_active_workspace();
+        const focusWindow = global.display.focus_window;
+
+        // Windows are listed in stacking order, from bottom to top.
+        const metaWindows = global.get_window_actors()
+            .map(actor => actor.meta_window)
+            .filter(w => !w.is_skip_taskbar());
+        const windows = global.display.sort_windows_by_stacking(metaWindows)
+            .map(w => ({
+                id: w.get_id(),
+                title: w.get_title() || '',
+                wm_class: w.get_wm_class() || '',
+                wm_class_instance: w.get_wm_class_instance() || '',
+                role: w.get_role() || '',
+                pid: w.get_pid(),
+                rect: frameRect(w),
+                fullscreen: w.is_fullscreen(),
+                maximized: isMaximized(w),
+                workspace: w.is_on_all_workspaces() ? -1 : w.get_workspace().index(),
+                focus: w === focusWindow,
+                visible: !w.minimized && w.located_on_workspace(activeWorkspace),
+            }));
+
+        const workspaces = [];
+        for (let i = 0; i < workspaceManager.get_n_workspaces(); i++)
+            workspaces.push({index: i, name: Meta.prefs_get_workspace_name(i)});
+
+        return JSON.stringify({
+            windows,
+            workspaces,
+            current_workspace: activeWorkspace.index(),
+        });
+    }
+}
@@ -2,9 +2,9 @@ package thyme
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"hash/fnv"
-	"log"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -91,20 +91,49 @@ end repeat
 `
 )
 
+// Capabilities reports no idle support because System Events doesn't
+// report how long the user has been idle.
+func (t *DarwinTracker) Capabilities() Capabilities {
+	return Capabilities{Visibility: true}
+}
+
 func (t *DarwinTracker) Deps() string {
 	return `
 You will need to enable privileges for "Terminal" in System Preferences > Security & Privacy > Privacy > Accessibility.
 See https://support.apple.com/en-us/HT202802 for details.
 
-Note: this command prints out this message regardless of whether this has been done or not.
+Note: this command prints out this message regardless of whether this has been done or not. Run "thyme dep --check"
+to check.
 `
 }
 
-func (t *DarwinTracker) Snap() (*Snapshot, error) {
+func (t *DarwinTracker) CheckDeps() []*Dependency {
+	return []*Dependency{
+		checkProgram(exec.LookPath, "osascript", false, nil),
+		checkProbe("Accessibility privileges", func() error {
+			out, err := exec.Command("osascript", "-e", `tell application "System Events" to count processes`).CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(out)))
+			}
+			return nil
+		}, map[string]string{
+			"darwin": "enable privileges for your terminal in System Preferences > Security & Privacy > Privacy > Accessibility",
+		}),
+	}
+}
+
+func (t *DarwinTracker) Probe() error {
+	if err := requireGOOS("darwin"); err != nil {
+		return err
+	}
+	return requirePrograms(exec.LookPath, "osascript")
+}
+
+func (t *DarwinTracker) Snap(ctx context.Context) (*Snapshot, error) {
 	var allWindows []*Window
 	var allProcWins map[process][]*Window
 	{
-		procWins, err := runAS(allWindowsScript)
+		procWins, err := runAS(ctx, allWindowsScript)
 		if err != nil {
 			return nil, err
 		}
@@ -120,7 +149,7 @@ func (t *DarwinTracker) Snap() (*Snapshot, error) {
 
 	var active int64
 	{
-		procWins, err := runAS(activeWindowsScript)
+		procWins, err := runAS(ctx, activeWindowsScript)
 		if err != nil {
 			return nil, err
 		}
@@ -139,8 +168,9 @@ func (t *DarwinTracker) Snap() (*Snapshot, error) {
 	}
 
 	var visible []int64
+	var warnings []string
 	{
-		procWins, err := runAS(visibleWindowsScript)
+		procWins, err := runAS(ctx, visibleWindowsScript)
 		if err != nil {
 			return nil, err
 		}
@@ -159,7 +189,7 @@ func (t *DarwinTracker) Snap() (*Snapshot, error) {
 						}
 					}
 					if !found {
-						log.Printf("warning: window ID not found for visible window %q", visWin.Name)
+						warnings = append(warnings, fmt.Sprintf("window ID not found for visible window %q", visWin.Name))
 					}
 				}
 			}
@@ -167,10 +197,11 @@ func (t *DarwinTracker) Snap() (*Snapshot, error) {
 	}
 
 	return &Snapshot{
-		Time:    time.Now(),
-		Windows: allWindows,
-		Active:  active,
-		Visible: visible,
+		Time:     time.Now(),
+		Windows:  allWindows,
+		Active:   active,
+		Visible:  visible,
+		Warnings: warnings,
 	}, nil
 }
 
@@ -181,11 +212,15 @@ type process struct {
 }
 
 // runAS runs script as AppleScript and parses the output into a map of
-// processes to windows.
-func runAS(script string) (map[process][]*Window, error) {
-	cmd := exec.Command("osascript")
+// processes to windows. osascript is killed if ctx is done before it
+// exits.
+func runAS(ctx context.Context, script string) (map[process][]*Window, error) {
+	cmd := exec.CommandContext(ctx, "osascript")
 	cmd.Stdin = bytes.NewBuffer([]byte(script))
 	b, err := cmd.CombinedOutput()
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("AppleScript error: %s, output was:\n%s", err, string(b))
 	}
@@ -2,8 +2,9 @@ package thyme
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"log"
+	"sort"
 	"strings"
 	"time"
 )
@@ -12,20 +13,32 @@ import (
 // the RegisterTracker function to make themselves available.
 var trackers = make(map[string]func() Tracker)
 
-// RegisterTracker makes a Tracker constructor available to clients of this package.
+// RegisterTracker makes a Tracker constructor available to clients of this package. It panics if a Tracker has already
+// been registered with the same name, as that is a programming error.
 func RegisterTracker(name string, t func() Tracker) {
 	if _, exists := trackers[name]; exists {
-		log.Fatalf("a tracker already exists with the name %s", name)
+		panic(fmt.Sprintf("a tracker already exists with the name %s", name))
 	}
 	trackers[name] = t
 }
 
 // NewTracker returns a new Tracker instance whose type is `name`.
-func NewTracker(name string) Tracker {
+func NewTracker(name string) (Tracker, error) {
 	if _, exists := trackers[name]; !exists {
-		log.Fatalf("no Tracker constructor has been registered with name %s", name)
+		return nil, fmt.Errorf("no Tracker constructor has been registered with name %s", name)
 	}
-	return trackers[name]()
+	return trackers[name](), nil
+}
+
+// Trackers returns the names of all registered Tracker types in
+// alphabetical order.
+func Trackers() []string {
+	names := make([]string, 0, len(trackers))
+	for name := range trackers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // Tracker tracks application usage. An implementation that satisfies
@@ -33,18 +46,90 @@ func NewTracker(name string) Tracker {
 // supports.
 type Tracker interface {
 	// Snap returns a Snapshot reflecting the currently in-use windows
-	// at the current time.
-	Snap() (*Snapshot, error)
+	// at the current time. It gives up and returns an error once ctx
+	// is done, killing any external programs it started.
+	Snap(ctx context.Context) (*Snapshot, error)
 
 	// Deps returns a string listing the dependencies that still need
 	// to be installed with instructions for how to install them.
 	Deps() string
+
+	// Capabilities returns which parts of a Snapshot the Tracker
+	// fills in.
+	Capabilities() Capabilities
+}
+
+// Capabilities describes which parts of a Snapshot a Tracker fills
+// in. Reports use it to avoid presenting missing data as if it were
+// real (e.g., showing that no windows were visible when the Tracker
+// simply can't tell).
+type Capabilities struct {
+	// Visibility is true if Snapshot.Visible is filled in.
+	Visibility bool
+
+	// Idle is true if Snapshot.Idle is filled in.
+	Idle bool
+}
+
+// Intersect returns the capabilities that both c and other have.
+func (c Capabilities) Intersect(other Capabilities) Capabilities {
+	return Capabilities{
+		Visibility: c.Visibility && other.Visibility,
+		Idle:       c.Idle && other.Idle,
+	}
+}
+
+// Prober is implemented by Trackers that can check whether they are
+// able to run in the current environment.
+type Prober interface {
+	// Probe returns a non-nil error explaining why the Tracker
+	// can't take snapshots in the current environment (e.g.,
+	// because the windowing system it supports isn't running).
+	Probe() error
 }
 
 // Stream represents all the sampling data gathered by Thyme.
 type Stream struct {
 	// Snapshots is a list of window snapshots ordered by time.
 	Snapshots []*Snapshot
+
+	// Capabilities describes which parts of the snapshots are filled
+	// in: a capability is listed only if every Tracker that recorded
+	// the stream has it. Stores record it once per stream rather than
+	// in every snapshot (see Store.SetCapabilities). It is nil for
+	// streams recorded by older versions of Thyme.
+	Capabilities *Capabilities `json:",omitempty"`
+}
+
+// Supported returns the Capabilities of the Trackers that recorded
+// the stream. Streams recorded before Thyme stored capabilities are
+// assumed to have them all.
+func (s Stream) Supported() Capabilities {
+	if s.Capabilities == nil {
+		return Capabilities{Visibility: true, Idle: true}
+	}
+	return *s.Capabilities
+}
+
+// addCapabilities records that a Tracker with caps recorded (part of)
+// the stream.
+func (s *Stream) addCapabilities(caps Capabilities) {
+	if s.Capabilities != nil {
+		caps = s.Capabilities.Intersect(caps)
+	}
+	s.Capabilities = &caps
+}
+
+// Gaps returns the number of gap markers in the stream (see
+// Snapshot.IsGap).
+func (s Stream) Gaps() int {
+	var n int
+	for _, snap := range s.Snapshots {
+		if snap.IsGap() {
+			n++
+		}
+	}
+	return n
 }
 
 // Print returns a pretty-printed representation of the snapshot.
@@ -63,6 +148,77 @@ type Snapshot struct {
 	Windows []*Window
 	Active  int64
 	Visible []int64
+
+	// Idle is how long it had been since the user last provided
+	// input (e.g., via keyboard or mouse) when the snapshot was
+	// taken. It is zero if the Tracker doesn't support idle
+	// detection.
+	Idle time.Duration `json:",omitempty"`
+
+	// Desktops lists the desktops (or workspaces) that existed when
+	// the snapshot was taken. It is empty if the Tracker doesn't
+	// record desktops.
+	Desktops []*Desktop `json:",omitempty"`
+
+	// CurrentDesktop is the ID (see Desktop.ID) of the desktop that
+	// was shown (or, with several monitors, focused) when the
+	// snapshot was taken. It is nil if the Tracker doesn't record
+	// it.
+	CurrentDesktop *int64 `json:",omitempty"`
+
+	// VisibleFraction maps the IDs of visible windows to the
+	// fraction (between 0 and 1) of their area that was on screen
+	// and not covered by other windows. It is empty if the Tracker
+	// doesn't know the stacking order of windows; visible windows
+	// that are missing from it count as fully visible.
+	VisibleFraction map[int64]float64 `json:",omitempty"`
+
+	// Monitors lists the monitors that were active when the snapshot
+	// was taken, along with the windows visible on each. It is empty
+	// if the Tracker doesn't record monitors.
+	Monitors []*Monitor `json:",omitempty"`
+
+	// Warnings lists problems the Tracker worked around while taking
+	// the snapshot (e.g., a window that closed before its details
+	// could be read, and was left out).
+	Warnings []string `json:",omitempty"`
+
+	// Gap is the error that prevented the Tracker from taking the
+	// snapshot. If it is non-empty, the snapshot is a gap marker:
+	// only Time is set, and reports treat the time until the next
+	// snapshot as missing data.
+	Gap string `json:",omitempty"`
+}
+
+// NewGap returns a gap marker recording that no snapshot could be
+// taken at time t because of err.
+func NewGap(t time.Time, err error) *Snapshot {
+	return &Snapshot{Time: t, Gap: err.Error()}
+}
+
+// IsGap returns true if the snapshot is a gap marker (see
+// Snapshot.Gap).
+func (s Snapshot) IsGap() bool {
+	return s.Gap != ""
+}
+
+// IsAway returns true if the user had been idle for longer than
+// threshold when the snapshot was taken. A threshold of zero
+// disables idle detection.
+func (s Snapshot) IsAway(threshold time.Duration) bool {
+	return threshold > 0 && s.Idle > threshold
+}
+
+// DesktopName returns the name of the desktop with the specified ID,
+// or "Desktop <id>" if the desktop has no name or isn't listed in
+// s.Desktops.
+func (s Snapshot) DesktopName(id int64) string {
+	for _, d := range s.Desktops {
+		if d.ID == id && d.Name != "" {
+			return d.Name
+		}
+	}
+	return fmt.Sprintf("Desktop %d", id)
 }
 
 // Print returns a pretty-printed representation of the snapshot.
@@ -88,6 +244,19 @@ s_Windows:
 	}
 
 	fmt.Fprintf(&b, "%s\n", s.Time.Format("Mon Jan 2 15:04:05 -0700 MST 2006"))
+	if s.IsGap() {
+		fmt.Fprintf(&b, "\tNo data: %s\n", s.Gap)
+		return string(b.Bytes())
+	}
+	for _, warning := range s.Warnings {
+		fmt.Fprintf(&b, "\tWarning: %s\n", warning)
+	}
+	if s.Idle > 0 {
+		fmt.Fprintf(&b, "\tIdle: %s\n", s.Idle)
+	}
+	if s.CurrentDesktop != nil {
+		fmt.Fprintf(&b, "\tDesktop: %s\n", s.DesktopName(*s.CurrentDesktop))
+	}
 	if active != nil {
 		fmt.Fprintf(&b, "\tActive: %s\n", active.Info().Print())
 	}
@@ -114,12 +283,91 @@ type Window struct {
 	ID int64
 
 	// Desktop is the numerical identifier of the desktop the
-	// window belongs to.  Equal to -1 if the window is sticky.
+	// window belongs to.  Equal to -1 if the window is sticky, and
+	// to UnknownDesktop if the Tracker couldn't tell.
 	Desktop int64
 
 	// Name is the display name of the window (typically what the
 	// windowing system shows in the top bar of the window).
 	Name string
+
+	// Class identifies the application that owns the window, as
+	// reported by the windowing system (e.g., "firefox"): the class
+	// part of WM_CLASS on X11, or the app_id on Wayland. It is empty
+	// if the Tracker doesn't record it.
+	Class string `json:",omitempty"`
+
+	// Instance is the instance part of WM_CLASS (e.g., "Navigator"),
+	// which distinguishes between different kinds of windows of the
+	// same application. It is empty if the Tracker doesn't record it.
+	Instance string `json:",omitempty"`
+
+	// Role is the WM_WINDOW_ROLE of the window (e.g., "browser"). It
+	// is empty if the window doesn't set one or the Tracker doesn't
+	// record it.
+	Role string `json:",omitempty"`
+
+	// PID is the ID of the process that owns the window. It is zero
+	// if the Tracker doesn't record it.
+	PID int64 `json:",omitempty"`
+
+	// Exe is the path of the executable of the process that owns the
+	// window (e.g., "/usr/lib/firefox/firefox"). It is empty if the
+	// Tracker can't determine it.
+	Exe string `json:",omitempty"`
+
+	// Monitor is the name of the monitor (or output) the window is
+	// on. It is empty if the Tracker doesn't record it.
+	Monitor string `json:",omitempty"`
+
+	// Geometry is the position and size of the window on the screen.
+	// It is nil if the Tracker doesn't record it.
+	Geometry *Rect `json:",omitempty"`
+
+	// Fullscreen is true if the window was fullscreen.
+	Fullscreen bool `json:",omitempty"`
+
+	// Maximized is true if the window was maximized (both
+	// horizontally and vertically).
+	Maximized bool `json:",omitempty"`
+
+	// Minimized is true if the window was minimized (or otherwise
+	// hidden by the window manager), in which case it isn't visible.
+	Minimized bool `json:",omitempty"`
+}
+
+// Rect is a rectangle on the screen. X and Y are the coordinates of
+// its top-left corner relative to the top-left corner of the screen
+// (across all monitors).
+type Rect struct {
+	X, Y          int
+	Width, Height int
+}
+
+// Monitor represents a monitor (or output) that shows part of the
+// screen.
+type Monitor struct {
+	// Name is the name of the monitor (e.g., "HDMI-1"), as used by
+	// Window.Monitor. It is empty if the tracker only knows the size
+	// of the whole screen.
+	Name string
+
+	// Geometry is the part of the screen the monitor shows.
+	Geometry Rect
+
+	// Visible lists the IDs of the windows that are at least
+	// partly visible on the monitor.
+	Visible []int64 `json:",omitempty"`
+}
+
+// Desktop represents a virtual desktop (also called a workspace).
+type Desktop struct {
+	// ID is the numerical identifier of the desktop, as used by
+	// Window.Desktop.
+	ID int64
+
+	// Name is the display name of the desktop.
+	Name string
 }
 
 // systemNames is a set of excluded window names that are known to
@@ -143,6 +391,11 @@ func (w *Window) IsSystem() bool {
 	return false
 }
 
+// UnknownDesktop is the Desktop of a window whose desktop the
+// Tracker couldn't determine. Such a window isn't considered to be
+// on any desktop, so it is never visible.
+const UnknownDesktop = -2
+
 // IsSticky returns true if the window is a sticky window (i.e.
 // present on all desktops)
 func (w *Window) IsSticky() bool {
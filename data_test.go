@@ -0,0 +1,20 @@
+package thyme
+
+import (
+	"testing"
+)
+
+func TestNewTrackerUnknown(t *testing.T) {
+	if tr, err := NewTracker("bogus"); err == nil {
+		t.Errorf("got tracker %T and no error for an unregistered name", tr)
+	}
+}
+
+func TestRegisterTrackerDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a tracker twice didn't panic")
+		}
+	}()
+	RegisterTracker("linux", NewLinuxTracker)
+}
@@ -0,0 +1,19 @@
+package thyme
+
+import (
+	"context"
+
+	"github.com/godbus/dbus"
+)
+
+// dbusCall calls method on obj like obj.Call does, but gives up
+// waiting for the reply once ctx is done.
+func dbusCall(ctx context.Context, obj dbus.BusObject, method string, args ...interface{}) *dbus.Call {
+	call := obj.Go(method, 0, make(chan *dbus.Call, 1), args...)
+	select {
+	case call = <-call.Done:
+		return call
+	case <-ctx.Done():
+		return &dbus.Call{Err: ctx.Err()}
+	}
+}
@@ -0,0 +1,89 @@
+package thyme
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus"
+)
+
+// testBus is a private session bus shared by all tests in the
+// package, since dbus.SessionBus keeps its connection for the life of
+// the process.
+var testBus struct {
+	once sync.Once
+	cmd  *exec.Cmd
+	err  error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if testBus.cmd != nil {
+		testBus.cmd.Process.Kill()
+		testBus.cmd.Wait()
+	}
+	os.Exit(code)
+}
+
+// startSessionBus starts a private session bus, unless one is already
+// running, and points DBUS_SESSION_BUS_ADDRESS at it. The test is
+// skipped if dbus-daemon isn't installed.
+func startSessionBus(t *testing.T) {
+	path, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+	testBus.once.Do(func() {
+		cmd := exec.Command(path, "--session", "--nofork", "--print-address")
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			testBus.err = err
+			return
+		}
+		if err := cmd.Start(); err != nil {
+			testBus.err = err
+			return
+		}
+		testBus.cmd = cmd
+		address, err := bufio.NewReader(stdout).ReadString('\n')
+		if err != nil {
+			testBus.err = fmt.Errorf("could not read address from dbus-daemon: %s", err)
+			return
+		}
+		testBus.err = os.Setenv("DBUS_SESSION_BUS_ADDRESS", strings.TrimSpace(address))
+	})
+	if testBus.err != nil {
+		t.Fatal(testBus.err)
+	}
+}
+
+// sessionConn returns a new connection to the private session bus that
+// owns name, for a fake service to export its objects on. The
+// connection is closed, releasing name, at the end of the test.
+func sessionConn(t *testing.T, name string) *dbus.Conn {
+	startSessionBus(t)
+	conn, err := dbus.SessionBusPrivate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := conn.Auth(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Hello(); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conn.RequestName(name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("could not become the owner of %s on the session bus", name)
+	}
+	return conn
+}
@@ -0,0 +1,56 @@
+package thyme
+
+// DepChecker is implemented by Trackers that can check whether their
+// external dependencies are present, complementing the static
+// instructions returned by Tracker.Deps.
+type DepChecker interface {
+	// CheckDeps checks each of the Tracker's dependencies.
+	CheckDeps() []*Dependency
+}
+
+// Dependency is the result of checking for one of a Tracker's
+// external dependencies.
+type Dependency struct {
+	// Name is the name of the dependency (e.g., a program name).
+	Name string
+
+	// Found is true if the dependency is present.
+	Found bool
+
+	// Detail describes where the dependency was found (e.g., the
+	// path of a program) or why it wasn't.
+	Detail string
+
+	// Optional is true if the Tracker works without the
+	// dependency, albeit with reduced functionality.
+	Optional bool
+
+	// Install maps Linux distributions and other operating systems
+	// (e.g., "debian") to instructions for installing the
+	// dependency there.
+	Install map[string]string
+}
+
+// checkProgram checks for a program with lookPath (e.g.,
+// exec.LookPath).
+func checkProgram(lookPath func(string) (string, error), name string, optional bool, install map[string]string) *Dependency {
+	dep := &Dependency{Name: name, Optional: optional, Install: install}
+	if path, err := lookPath(name); err != nil {
+		dep.Detail = "not found in PATH"
+	} else {
+		dep.Found, dep.Detail = true, path
+	}
+	return dep
+}
+
+// checkProbe checks for a dependency that is detected by probe (e.g.,
+// by connecting to a service) rather than by looking for a program.
+func checkProbe(name string, probe func() error, install map[string]string) *Dependency {
+	dep := &Dependency{Name: name, Install: install}
+	if err := probe(); err != nil {
+		dep.Detail = err.Error()
+	} else {
+		dep.Found, dep.Detail = true, "ok"
+	}
+	return dep
+}
@@ -0,0 +1,152 @@
+package thyme
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// probeTimeout is the longest a Tracker's Probe waits for a reply from
+// the windowing system, so that detection doesn't hang if, e.g., a
+// D-Bus service doesn't respond.
+var probeTimeout = 2 * time.Second
+
+// trackerPreference lists Trackers in the order DetectTracker
+// considers them. Trackers for specific window managers come before
+// the generic X11 trackers, which in turn come before the GNOME and
+// KDE trackers, since on X11 the X11 trackers work on those desktops
+// without any setup. Registered Trackers not in this list are
+// considered last, in alphabetical order.
+var trackerPreference = []string{
+	"windows",
+	"darwin",
+	"sway",
+	"hyprland",
+	"i3",
+	"linux",
+	"x11",
+	"gnome",
+	"kwin",
+}
+
+// DetectTracker returns the name of the registered Tracker best
+// suited to the current environment: the first one, in order of
+// preference, whose probe succeeds (see ProbeTracker).
+func DetectTracker() (string, error) {
+	names := append([]string(nil), trackerPreference...)
+	for _, name := range Trackers() {
+		if !contains(trackerPreference, name) {
+			names = append(names, name)
+		}
+	}
+
+	var reasons []string
+	for _, name := range names {
+		if _, registered := trackers[name]; !registered {
+			continue
+		}
+		if err := ProbeTracker(name); err != nil {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("could not detect a suitable tracker for this environment (%s)", strings.Join(reasons, "; "))
+}
+
+// ProbeTracker returns a non-nil error if the Tracker whose type is
+// `name` can't run in the current environment. Trackers that don't
+// implement Prober are assumed to be able to run anywhere.
+func ProbeTracker(name string) error {
+	t, err := NewTracker(name)
+	if err != nil {
+		return err
+	}
+	if p, ok := t.(Prober); ok {
+		return p.Probe()
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isWayland returns true if the current session is a Wayland session.
+func isWayland() bool {
+	return os.Getenv("XDG_SESSION_TYPE") == "wayland" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// requireGOOS returns an error unless the program runs on goos.
+func requireGOOS(goos string) error {
+	if runtime.GOOS != goos {
+		return fmt.Errorf("requires %s", goos)
+	}
+	return nil
+}
+
+// requireEnv returns an error unless the environment variable name is
+// set.
+func requireEnv(name string) error {
+	if os.Getenv(name) == "" {
+		return fmt.Errorf("%s is not set", name)
+	}
+	return nil
+}
+
+// requireDesktop returns an error unless desktop is one of the
+// desktop environments listed in XDG_CURRENT_DESKTOP.
+func requireDesktop(desktop string) error {
+	for _, d := range strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":") {
+		if strings.EqualFold(d, desktop) {
+			return nil
+		}
+	}
+	return fmt.Errorf("XDG_CURRENT_DESKTOP does not include %s", desktop)
+}
+
+// requireX11 returns an error unless this is an X11 session. Wayland
+// sessions are rejected even if DISPLAY is set, because Xwayland only
+// exposes the windows of X11 applications.
+func requireX11() error {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return fmt.Errorf("requires X11, which is not used on %s", runtime.GOOS)
+	}
+	if isWayland() {
+		return fmt.Errorf("requires X11, but this is a Wayland session")
+	}
+	return requireEnv("DISPLAY")
+}
+
+// requirePrograms returns an error unless lookPath (e.g.,
+// exec.LookPath) finds all of the named programs.
+func requirePrograms(lookPath func(string) (string, error), names ...string) error {
+	var missing []string
+	for _, name := range names {
+		if _, err := lookPath(name); err != nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s (see `thyme dep`)", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// requireSocket returns an error unless a server is listening on the
+// Unix socket at path.
+func requireSocket(path string) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
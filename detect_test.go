@@ -0,0 +1,223 @@
+package thyme
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// detectEnv lists the environment variables the Trackers' probes look
+// at.
+var detectEnv = []string{
+	"SWAYSOCK",
+	"HYPRLAND_INSTANCE_SIGNATURE",
+	"XDG_RUNTIME_DIR",
+	"I3SOCK",
+	"DISPLAY",
+	"WAYLAND_DISPLAY",
+	"XDG_SESSION_TYPE",
+	"XDG_CURRENT_DESKTOP",
+}
+
+// setDetectEnv clears the environment variables the Trackers' probes
+// look at, except for those in env, for the duration of the test.
+// "$DIR" in the values of env is replaced with dir.
+func setDetectEnv(t *testing.T, env map[string]string, dir string) {
+	for _, name := range detectEnv {
+		t.Setenv(name, strings.Replace(env[name], "$DIR", dir, -1))
+	}
+}
+
+// listenUnix listens on a Unix socket at path, creating its parent
+// directories, for the duration of the test.
+func listenUnix(t *testing.T, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+}
+
+// replaceTracker registers newTracker as the constructor of the
+// Tracker whose type is name for the duration of the test. A nil
+// newTracker unregisters it.
+func replaceTracker(t *testing.T, name string, newTracker func() Tracker) {
+	old, registered := trackers[name]
+	if newTracker == nil {
+		delete(trackers, name)
+	} else {
+		trackers[name] = newTracker
+	}
+	t.Cleanup(func() {
+		if registered {
+			trackers[name] = old
+		} else {
+			delete(trackers, name)
+		}
+	})
+}
+
+// fakeProber is a Tracker whose probe calls probe.
+type fakeProber struct {
+	Tracker
+	probe func() error
+}
+
+func (p *fakeProber) Probe() error {
+	return p.probe()
+}
+
+func TestDetectTracker(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("detection on Linux")
+	}
+	tests := []struct {
+		name         string
+		env          map[string]string
+		sockets      []string
+		missing      []string
+		unregistered []string
+		want         string
+	}{{
+		name:    "sway",
+		env:     map[string]string{"SWAYSOCK": "$DIR/sway-ipc.sock", "WAYLAND_DISPLAY": "wayland-1", "DISPLAY": ":0"},
+		sockets: []string{"sway-ipc.sock"},
+		want:    "sway",
+	}, {
+		name:    "Hyprland",
+		env:     map[string]string{"HYPRLAND_INSTANCE_SIGNATURE": "0a1b2c3d", "XDG_RUNTIME_DIR": "$DIR", "WAYLAND_DISPLAY": "wayland-1", "DISPLAY": ":0"},
+		sockets: []string{"hypr/0a1b2c3d/.socket.sock"},
+		want:    "hyprland",
+	}, {
+		name:    "i3",
+		env:     map[string]string{"I3SOCK": "$DIR/ipc-socket.1", "DISPLAY": ":0"},
+		sockets: []string{"ipc-socket.1"},
+		want:    "i3",
+	}, {
+		name: "sway isn't listening",
+		env:  map[string]string{"SWAYSOCK": "$DIR/sway-ipc.sock", "DISPLAY": ":0"},
+		want: "linux",
+	}, {
+		name: "X11",
+		env:  map[string]string{"DISPLAY": ":0"},
+		want: "linux",
+	}, {
+		// KDE on X11 uses the X11 trackers, which need no setup.
+		name: "KDE on X11",
+		env:  map[string]string{"DISPLAY": ":0", "XDG_SESSION_TYPE": "x11", "XDG_CURRENT_DESKTOP": "KDE"},
+		want: "linux",
+	}, {
+		name:    "X11 without wmctrl",
+		env:     map[string]string{"DISPLAY": ":0"},
+		missing: []string{"wmctrl"},
+		want:    "x11",
+	}, {
+		name:         "X11 without the linux tracker",
+		env:          map[string]string{"DISPLAY": ":0"},
+		unregistered: []string{"linux"},
+		want:         "x11",
+	}, {
+		// Xwayland sets DISPLAY, but only shows X11 applications.
+		name: "GNOME on Wayland",
+		env:  map[string]string{"DISPLAY": ":0", "WAYLAND_DISPLAY": "wayland-0", "XDG_CURRENT_DESKTOP": "ubuntu:GNOME"},
+		want: "gnome",
+	}, {
+		name: "KDE on Wayland",
+		env:  map[string]string{"DISPLAY": ":1", "XDG_SESSION_TYPE": "wayland", "XDG_CURRENT_DESKTOP": "KDE"},
+		want: "kwin",
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "thyme")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.RemoveAll(dir) })
+			setDetectEnv(t, test.env, dir)
+			for _, socket := range test.sockets {
+				listenUnix(t, filepath.Join(dir, socket))
+			}
+
+			// The probes of these Trackers need a live X server or
+			// D-Bus service, which the tests of each Tracker cover.
+			replaceTracker(t, "x11", func() Tracker { return &fakeProber{probe: requireX11} })
+			replaceTracker(t, "gnome", func() Tracker {
+				return &fakeProber{probe: func() error { return requireDesktop("GNOME") }}
+			})
+			replaceTracker(t, "kwin", func() Tracker {
+				return &fakeProber{probe: func() error { return requireDesktop("KDE") }}
+			})
+			replaceTracker(t, "linux", func() Tracker {
+				r := loadFakeRunner(t, "minimal")
+				for _, name := range test.missing {
+					delete(r.programs, name)
+				}
+				return NewLinuxTrackerWithRunner(r)
+			})
+			for _, name := range test.unregistered {
+				replaceTracker(t, name, nil)
+			}
+
+			got, err := DetectTracker()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got tracker %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDetectTrackerNone(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("detection on Linux")
+	}
+	setDetectEnv(t, map[string]string{"WAYLAND_DISPLAY": "wayland-0", "XDG_CURRENT_DESKTOP": "weston"}, "")
+	_, err := DetectTracker()
+	if err == nil {
+		t.Fatal("got no error for an unsupported Wayland compositor")
+	}
+	// The error explains why each tracker was rejected.
+	for _, name := range []string{"sway", "hyprland", "linux", "gnome", "kwin"} {
+		if !strings.Contains(err.Error(), name+": ") {
+			t.Errorf("error %q doesn't explain why %s was rejected", err, name)
+		}
+	}
+}
+
+func TestDetectTrackerUnlisted(t *testing.T) {
+	setDetectEnv(t, nil, "")
+	for _, name := range trackerPreference {
+		replaceTracker(t, name, nil)
+	}
+	replaceTracker(t, "b", func() Tracker { return &fakeProber{probe: func() error { return nil }} })
+	replaceTracker(t, "a", func() Tracker { return &fakeProber{probe: requireX11} })
+	// Trackers missing from trackerPreference are considered in
+	// alphabetical order.
+	got, err := DetectTracker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "b" {
+		t.Errorf("got tracker %q, want %q", got, "b")
+	}
+}
+
+func TestProbeTracker(t *testing.T) {
+	if err := ProbeTracker("bogus"); err == nil {
+		t.Error("got no error for an unregistered tracker")
+	}
+	// Trackers that don't implement Prober can run anywhere.
+	replaceTracker(t, "noprobe", func() Tracker { return struct{ Tracker }{} })
+	if err := ProbeTracker("noprobe"); err != nil {
+		t.Errorf("got error %v for a tracker without a probe", err)
+	}
+}
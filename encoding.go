@@ -0,0 +1,144 @@
+package thyme
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StreamFormat identifies how a Stream is encoded.
+type StreamFormat int
+
+const (
+	// FormatEmpty means the stream contains no data.
+	FormatEmpty StreamFormat = iota
+
+	// FormatLegacy (schema version 1) is a single JSON object of the
+	// form {"Snapshots": [...]}, as written by older versions of
+	// Thyme.
+	FormatLegacy
+
+	// FormatJSONLines (schema version 2) is one JSON-encoded
+	// Snapshot per line (see EncodeSnapshot).
+	FormatJSONLines
+
+	// FormatMixed is data in the legacy format followed by JSON
+	// Lines, which is what results from appending snapshots to a
+	// file that was written in the legacy format.
+	FormatMixed
+)
+
+func (f StreamFormat) String() string {
+	switch f {
+	case FormatEmpty:
+		return "empty"
+	case FormatLegacy:
+		return "legacy JSON (schema version 1)"
+	case FormatJSONLines:
+		return "JSON Lines (schema version 2)"
+	case FormatMixed:
+		return "legacy JSON followed by JSON Lines (schema versions 1 and 2)"
+	}
+	return fmt.Sprintf("StreamFormat(%d)", int(f))
+}
+
+// DecodeStream reads a Stream from r. It understands two formats:
+//
+//  1. The legacy format, a single JSON object of the form {"Snapshots": [...]}
+//  2. JSON Lines, where each line holds a single Snapshot (see EncodeSnapshot)
+//     or a header of the form {"Capabilities": {...}} (see EncodeCapabilities)
+//
+// The two may be mixed, which is what results from appending
+// snapshots to a file that was written in the legacy format. A
+// truncated value at the very end of r (left behind by an
+// interrupted write) is ignored.
+func DecodeStream(r io.Reader) (*Stream, error) {
+	stream, _, err := InspectStream(r)
+	return stream, err
+}
+
+// InspectStream is like DecodeStream, but also reports the format of
+// the data.
+func InspectStream(r io.Reader) (*Stream, StreamFormat, error) {
+	var stream Stream
+	var hasLegacy, hasLines bool
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, FormatEmpty, err
+		}
+		// Snapshots have neither of these fields, so only a legacy
+		// stream or a header fills them in.
+		var header struct {
+			Snapshots    *[]*Snapshot
+			Capabilities *Capabilities
+		}
+		if err := json.Unmarshal(raw, &header); err != nil {
+			return nil, FormatEmpty, err
+		}
+		if header.Capabilities != nil {
+			stream.addCapabilities(*header.Capabilities)
+		}
+		if header.Snapshots != nil {
+			stream.Snapshots = append(stream.Snapshots, *header.Snapshots...)
+			hasLegacy = true
+			continue
+		}
+		if header.Capabilities != nil {
+			hasLines = true
+			continue
+		}
+		var snap Snapshot
+		if err := json.Unmarshal(raw, &snap); err != nil {
+			return nil, FormatEmpty, fmt.Errorf("could not decode snapshot: %s", err)
+		}
+		stream.Snapshots = append(stream.Snapshots, &snap)
+		hasLines = true
+	}
+
+	format := FormatEmpty
+	switch {
+	case hasLegacy && hasLines:
+		format = FormatMixed
+	case hasLegacy:
+		format = FormatLegacy
+	case hasLines:
+		format = FormatJSONLines
+	}
+	return &stream, format, nil
+}
+
+// EncodeSnapshot writes snap to w as a single line of JSON. The line
+// is written with a single call to w.Write, so appending to a file
+// opened with os.O_APPEND never interleaves partial lines.
+func EncodeSnapshot(w io.Writer, snap *Snapshot) error {
+	return json.NewEncoder(w).Encode(snap)
+}
+
+// EncodeCapabilities writes a header recording caps as the
+// Capabilities of the stream to w as a single line of JSON, like
+// EncodeSnapshot does. A stream may have several headers (e.g., if
+// different Trackers appended to it), in which case DecodeStream
+// intersects them.
+func EncodeCapabilities(w io.Writer, caps Capabilities) error {
+	return json.NewEncoder(w).Encode(struct{ Capabilities Capabilities }{caps})
+}
+
+// EncodeStream writes the capabilities (if known) and every snapshot
+// in stream to w in the JSON Lines format understood by DecodeStream.
+func EncodeStream(w io.Writer, stream *Stream) error {
+	if stream.Capabilities != nil {
+		if err := EncodeCapabilities(w, *stream.Capabilities); err != nil {
+			return err
+		}
+	}
+	for _, snap := range stream.Snapshots {
+		if err := EncodeSnapshot(w, snap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
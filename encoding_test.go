@@ -0,0 +1,134 @@
+package thyme
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeStream(t *testing.T) {
+	const (
+		legacy = `{
+  "Snapshots": [
+    {"Time": "2016-01-02T15:04:05Z", "Active": 1},
+    {"Time": "2016-01-02T15:04:35Z", "Active": 2}
+  ]
+}
+`
+		lines = `{"Time":"2016-01-02T15:05:05Z","Active":3}
+{"Time":"2016-01-02T15:05:35Z","Active":4}
+`
+	)
+	tests := []struct {
+		name   string
+		in     string
+		active []int64
+		caps   *Capabilities
+	}{
+		{"legacy only", legacy, []int64{1, 2}, nil},
+		{"JSON Lines only", lines, []int64{3, 4}, nil},
+		{"legacy followed by JSON Lines", legacy + lines, []int64{1, 2, 3, 4}, nil},
+		{"truncated last line", lines + `{"Time":"2016-01-02T15:06:0`, []int64{3, 4}, nil},
+		{"empty", "", nil, nil},
+		{
+			"header",
+			`{"Capabilities":{"Visibility":true,"Idle":false}}` + "\n" + lines,
+			[]int64{3, 4},
+			&Capabilities{Visibility: true},
+		},
+		{
+			// A Tracker without idle support appended to the
+			// stream after one without visibility support.
+			"several headers",
+			`{"Capabilities":{"Visibility":false,"Idle":true}}` + "\n" + lines + `{"Capabilities":{"Visibility":true,"Idle":false}}` + "\n",
+			[]int64{3, 4},
+			&Capabilities{},
+		},
+		{
+			"legacy with capabilities",
+			`{"Snapshots":[{"Time":"2016-01-02T15:04:05Z","Active":1}],"Capabilities":{"Visibility":false,"Idle":true}}`,
+			[]int64{1},
+			&Capabilities{Idle: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stream, err := DecodeStream(strings.NewReader(test.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var active []int64
+			for _, snap := range stream.Snapshots {
+				active = append(active, snap.Active)
+			}
+			if !reflect.DeepEqual(active, test.active) {
+				t.Errorf("got snapshots %v, want %v", active, test.active)
+			}
+			if !reflect.DeepEqual(stream.Capabilities, test.caps) {
+				t.Errorf("got capabilities %+v, want %+v", stream.Capabilities, test.caps)
+			}
+		})
+	}
+}
+
+func TestInspectStream(t *testing.T) {
+	const (
+		legacy = `{"Snapshots": [{"Time": "2016-01-02T15:04:05Z", "Active": 1}]}` + "\n"
+		header = `{"Capabilities":{"Visibility":true,"Idle":true}}` + "\n"
+		line   = `{"Time":"2016-01-02T15:05:05Z","Active":2}` + "\n"
+	)
+	tests := []struct {
+		in   string
+		want StreamFormat
+	}{
+		{"", FormatEmpty},
+		{legacy, FormatLegacy},
+		{line, FormatJSONLines},
+		{header + line, FormatJSONLines},
+		{legacy + line, FormatMixed},
+	}
+	for _, test := range tests {
+		_, format, err := InspectStream(strings.NewReader(test.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != test.want {
+			t.Errorf("%q: got format %s, want %s", test.in, format, test.want)
+		}
+	}
+}
+
+func TestDecodeStreamInvalid(t *testing.T) {
+	in := `{"Time":"2016-01-02T15:05:05Z","Active":3}
+not json
+{"Time":"2016-01-02T15:05:35Z","Active":4}
+`
+	if _, err := DecodeStream(strings.NewReader(in)); err == nil {
+		t.Error("got no error decoding a corrupt line in the middle of the stream")
+	}
+}
+
+func TestEncodeStream(t *testing.T) {
+	stream := &Stream{
+		Snapshots: []*Snapshot{
+			{Active: 1, Windows: []*Window{{ID: 1, Desktop: -1, Name: "one"}}, Visible: []int64{1}},
+			{Active: 2, Windows: []*Window{{ID: 2, Desktop: 0, Name: "two"}}, Visible: []int64{2}},
+		},
+		Capabilities: &Capabilities{Visibility: true},
+	}
+	var buf bytes.Buffer
+	if err := EncodeStream(&buf, stream); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != len(stream.Snapshots)+1 {
+		t.Errorf("got %d lines, want a header and one per snapshot", n)
+	}
+	got, err := DecodeStream(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, stream) {
+		t.Errorf("round trip changed the stream:\ngot  %+v\nwant %+v", got, stream)
+	}
+}
@@ -0,0 +1,232 @@
+package thyme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileLock is an exclusive advisory lock on a data file. Every
+// process that writes the data file through this package acquires
+// the lock first, so concurrent writers (e.g., a cron job and a
+// shell loop both running `thyme track`) take turns instead of
+// clobbering each other's data.
+//
+// The lock is held on a sidecar file named after the data file with
+// a ".lock" suffix rather than on the data file itself, because the
+// data file may be replaced by a rename while the lock is held (see
+// WriteFileAtomic).
+type FileLock struct {
+	f *os.File
+}
+
+// LockFile blocks until it acquires the lock for the data file at
+// path.
+func LockFile(path string) (*FileLock, error) {
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileLock{f: f}, nil
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	if err := unlockFile(l.f); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// AppendSnapshotFile appends snap as a single line to the file at
+// path, creating the file if it doesn't exist yet. It holds the
+// file's lock while doing so.
+//
+// If a previous append was interrupted (e.g., by a crash or a full
+// disk) and left a partial line at the end of the file, that partial
+// line is discarded before the new one is written. Anything else at
+// the end of the file is left alone (see repairTail).
+func AppendSnapshotFile(path string, snap *Snapshot) error {
+	return appendFile(path, func(f *os.File, end int64) error {
+		return EncodeSnapshot(f, snap)
+	})
+}
+
+// AppendCapabilitiesFile appends a header recording caps (see
+// EncodeCapabilities) to the file at path like AppendSnapshotFile
+// does, unless the stream in the file already has no capabilities
+// beyond caps. To find out, it reads the whole file.
+func AppendCapabilitiesFile(path string, caps Capabilities) error {
+	return appendFile(path, func(f *os.File, end int64) error {
+		stream, err := DecodeStream(io.NewSectionReader(f, 0, end))
+		if err != nil {
+			return err
+		}
+		if c := stream.Capabilities; c != nil && c.Intersect(caps) == *c {
+			return nil
+		}
+		return EncodeCapabilities(f, caps)
+	})
+}
+
+// appendFile calls write to append to the file at path, creating the
+// file if it doesn't exist yet, while holding the file's lock. When
+// write is called, f is positioned at its end, which is at offset
+// end, and ends with a newline unless it is empty (see repairTail).
+func appendFile(path string, write func(f *os.File, end int64) error) error {
+	lock, err := LockFile(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err := repairTail(f); err != nil {
+		f.Close()
+		return err
+	}
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := write(f, end); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// repairTail makes sure f ends with a newline, so that the next line
+// appended to it starts on a line of its own. If f holds nothing but
+// complete JSON values (e.g., a file in the legacy format without a
+// final newline), a newline is added. If everything but the last
+// line decodes and the last line fails to decode because it ends
+// before its value does, it is a snapshot whose append was
+// interrupted (see AppendSnapshotFile), and it is truncated. Anything
+// else (e.g., a database or text file passed by mistake) is an
+// error, and f is left unchanged.
+func repairTail(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	end := fi.Size()
+	start, err := lastLineStart(f, end)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return nil
+	}
+
+	err = decodeAll(io.NewSectionReader(f, 0, end))
+	if err == nil {
+		_, err = f.WriteAt([]byte("\n"), end)
+		return err
+	}
+	last := decodeAll(io.NewSectionReader(f, start, end-start))
+	if last == io.ErrUnexpectedEOF && decodeAll(io.NewSectionReader(f, 0, start)) == nil {
+		return f.Truncate(start)
+	}
+	return fmt.Errorf("%s doesn't end with a complete line and isn't a Thyme data file in JSON format (%s); refusing to append to it", f.Name(), err)
+}
+
+// decodeAll reads JSON values from r until EOF, returning the first
+// error it encounters. A value cut short by the end of r is reported
+// as io.ErrUnexpectedEOF.
+func decodeAll(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// lastLineStart returns the offset just after the last newline in the
+// first end bytes of f, or 0 if there is none.
+func lastLineStart(f *os.File, end int64) (int64, error) {
+	const chunkSize = 4096
+
+	buf := make([]byte, chunkSize)
+	for off := end; off > 0; {
+		n := int64(chunkSize)
+		if off < n {
+			n = off
+		}
+		off -= n
+		if _, err := f.ReadAt(buf[:n], off); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return off + int64(i) + 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// WriteFileAtomic replaces the contents of the file at path with
+// whatever write writes. The data is written to a temporary file in
+// the same directory, which is then renamed over path, so readers
+// (and a crash at any point) see either the old contents or the new
+// contents in full, never a mix or an empty file.
+//
+// WriteFileAtomic does not acquire the file's lock; callers that
+// read the file before rewriting it should hold the lock across both
+// operations.
+func WriteFileAtomic(path string, write func(io.Writer) error) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := write(tmp); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package thyme
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func tempDataFile(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "thyme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "thyme.json")
+}
+
+// TestConcurrentWriters appends snapshots from several goroutines
+// while others rewrite the file the way `thyme migrate` does, and
+// checks that every line decodes and no snapshot is lost.
+func TestConcurrentWriters(t *testing.T) {
+	path := tempDataFile(t)
+
+	const appenders, appends, rewriters, rewrites = 8, 50, 2, 20
+	var wg sync.WaitGroup
+	errs := make(chan error, appenders*appends+rewriters*rewrites)
+	for i := 0; i < appenders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < appends; j++ {
+				snap := &Snapshot{
+					Time:    time.Unix(int64(i*appends+j), 0),
+					Windows: []*Window{{ID: int64(i), Name: "writer"}},
+					Active:  int64(j),
+				}
+				if err := AppendSnapshotFile(path, snap); err != nil {
+					errs <- err
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < rewriters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rewrites; j++ {
+				errs <- rewrite(path)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	seen := make(map[int64]bool)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		var snap Snapshot
+		if err := json.Unmarshal(scanner.Bytes(), &snap); err != nil {
+			t.Fatalf("line %d: %s: %q", n, err, scanner.Text())
+		}
+		if seen[snap.Time.Unix()] {
+			t.Errorf("line %d: duplicate snapshot %d", n, snap.Time.Unix())
+		}
+		seen[snap.Time.Unix()] = true
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != appenders*appends {
+		t.Errorf("got %d snapshots, want %d", len(seen), appenders*appends)
+	}
+}
+
+// rewrite rewrites the file at path in place with WriteFileAtomic,
+// holding its lock.
+func rewrite(path string) error {
+	lock, err := LockFile(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	stream, err := DecodeStream(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, func(w io.Writer) error {
+		return EncodeStream(w, stream)
+	})
+}
+
+func TestAppendSnapshotFileTail(t *testing.T) {
+	snap := &Snapshot{Time: time.Unix(100, 0).UTC()}
+	var line bytes.Buffer
+	if err := EncodeSnapshot(&line, snap); err != nil {
+		t.Fatal(err)
+	}
+	first := `{"Time":"1970-01-01T00:00:01Z","Windows":null,"Active":0,"Visible":null}` + "\n"
+	legacy := `{"Snapshots":[{"Time":"1970-01-01T00:00:01Z","Windows":null,"Active":0,"Visible":null}]}`
+
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", data: "", want: line.String()},
+		{name: "complete", data: first, want: first + line.String()},
+		{name: "partial line", data: first + `{"Time":"1970-01-01T00:0`, want: first + line.String()},
+		{name: "partial prefix", data: first + `{"Ti`, want: first + line.String()},
+		{name: "only partial line", data: `{"Time":"1970`, want: line.String()},
+		{name: "legacy without newline", data: legacy, want: legacy + "\n" + line.String()},
+		{name: "legacy indented", data: "{\n  \"Snapshots\": []\n}", want: "{\n  \"Snapshots\": []\n}\n" + line.String()},
+		{name: "snapshot without newline", data: strings.TrimSuffix(first, "\n"), want: first + line.String()},
+		{name: "binary", data: "\x00\x00\x00\x00\xed\xda\x0c\xed\n\x02\x00\x00", wantErr: true},
+		{name: "garbage line", data: first + "hello", wantErr: true},
+		{name: "text", data: "date,app\n2016-01-02,emacs", wantErr: true},
+		{name: "text without newline", data: "date,app", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := tempDataFile(t)
+			if err := ioutil.WriteFile(path, []byte(test.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := AppendSnapshotFile(path, snap)
+			got, readErr := ioutil.ReadFile(path)
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+			if test.wantErr {
+				if err == nil {
+					t.Error("got no error")
+				}
+				if string(got) != test.data {
+					t.Errorf("file was changed to %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if _, err := DecodeStream(bytes.NewReader(got)); err != nil {
+				t.Errorf("could not decode result: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package thyme
+
+import (
+	"math"
+	"sort"
+)
+
+// Intersect returns the part of r that is also in s. Its area is
+// zero if r and s don't overlap.
+func (r Rect) Intersect(s Rect) Rect {
+	x0, y0 := maxInt(r.X, s.X), maxInt(r.Y, s.Y)
+	x1, y1 := minInt(r.X+r.Width, s.X+s.Width), minInt(r.Y+r.Height, s.Y+s.Height)
+	if x1 <= x0 || y1 <= y0 {
+		return Rect{}
+	}
+	return Rect{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0}
+}
+
+// Area returns the area of r.
+func (r Rect) Area() int {
+	return r.Width * r.Height
+}
+
+// placeWindows determines which windows in snap are visible from
+// their geometry. A window is visible if it is on currentDesktop, not
+// minimized, and overlaps at least one of monitors; comparing against
+// each monitor (rather than the bounding box of all of them) means
+// that windows in the gaps of an irregular layout don't count as
+// visible. It sets snap.Visible and snap.Monitors, and sets the
+// Monitor of each window to the monitor that shows the largest part
+// of it.
+func placeWindows(snap *Snapshot, monitors []*Monitor, currentDesktop int64) {
+	snap.Visible = nil
+	snap.Monitors = monitors
+	for _, w := range snap.Windows {
+		if w.Geometry == nil {
+			continue
+		}
+		shown := w.IsOnDesktop(currentDesktop) && !w.Minimized
+		var largest int
+		for _, m := range monitors {
+			area := w.Geometry.Intersect(m.Geometry).Area()
+			if area == 0 {
+				continue
+			}
+			if area > largest {
+				w.Monitor, largest = m.Name, area
+			}
+			if shown {
+				m.Visible = append(m.Visible, w.ID)
+			}
+		}
+		if largest > 0 && shown {
+			snap.Visible = append(snap.Visible, w.ID)
+		}
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// setVisibleFractions sets snap.VisibleFraction from the geometry of
+// the visible windows in snap and stacking, which lists window IDs in
+// stacking order from bottom to top. Each visible window is covered by
+// the visible windows above it and by the edges of snap.Monitors (if
+// known). Windows that are missing from stacking or have no geometry
+// are left out.
+func setVisibleFractions(snap *Snapshot, stacking []int64) {
+	if len(stacking) == 0 {
+		return
+	}
+	windows := make(map[int64]*Window, len(snap.Windows))
+	for _, w := range snap.Windows {
+		if w.Geometry != nil && w.Geometry.Area() > 0 {
+			windows[w.ID] = w
+		}
+	}
+	visible := make(map[int64]bool, len(snap.Visible))
+	for _, id := range snap.Visible {
+		visible[id] = true
+	}
+	var stack []*Window
+	for _, id := range stacking {
+		if w := windows[id]; w != nil && visible[id] {
+			stack = append(stack, w)
+		}
+	}
+
+	snap.VisibleFraction = make(map[int64]float64, len(stack))
+	for i, w := range stack {
+		var above []Rect
+		for _, a := range stack[i+1:] {
+			above = append(above, *a.Geometry)
+		}
+		var seen int
+		if len(snap.Monitors) == 0 {
+			seen = uncoveredArea(*w.Geometry, above)
+		}
+		for _, m := range snap.Monitors {
+			seen += uncoveredArea(w.Geometry.Intersect(m.Geometry), above)
+		}
+		snap.VisibleFraction[w.ID] = math.Min(1, float64(seen)/float64(w.Geometry.Area()))
+	}
+}
+
+// uncoveredArea returns the area of the part of r that isn't covered
+// by any of covers. It splits r into a grid along the edges of covers
+// and adds up the cells that no cover contains.
+func uncoveredArea(r Rect, covers []Rect) int {
+	if r.Area() == 0 {
+		return 0
+	}
+	xs, ys := []int{r.X, r.X + r.Width}, []int{r.Y, r.Y + r.Height}
+	var clipped []Rect
+	for _, c := range covers {
+		c = c.Intersect(r)
+		if c.Area() == 0 {
+			continue
+		}
+		clipped = append(clipped, c)
+		xs = append(xs, c.X, c.X+c.Width)
+		ys = append(ys, c.Y, c.Y+c.Height)
+	}
+	if len(clipped) == 0 {
+		return r.Area()
+	}
+	sort.Ints(xs)
+	sort.Ints(ys)
+
+	var area int
+	for i := 1; i < len(xs); i++ {
+		for j := 1; j < len(ys); j++ {
+			x, y := xs[i-1], ys[j-1]
+			w, h := xs[i]-x, ys[j]-y
+			if w == 0 || h == 0 {
+				continue
+			}
+			covered := false
+			for _, c := range clipped {
+				if c.X <= x && x < c.X+c.Width && c.Y <= y && y < c.Y+c.Height {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				area += w * h
+			}
+		}
+	}
+	return area
+}
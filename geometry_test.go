@@ -0,0 +1,288 @@
+package thyme
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlaceWindows(t *testing.T) {
+	// An L-shaped layout: a laptop screen with a taller monitor to
+	// its right, leaving a gap below the laptop's right edge.
+	lShaped := func() []*Monitor {
+		return []*Monitor{
+			{Name: "eDP-1", Geometry: Rect{0, 360, 1920, 1080}},
+			{Name: "DP-1", Geometry: Rect{1920, 0, 2560, 1440}},
+		}
+	}
+	// A monitor to the left of the primary one, at negative
+	// coordinates.
+	leftOfPrimary := func() []*Monitor {
+		return []*Monitor{
+			{Name: "HDMI-1", Geometry: Rect{-1280, 0, 1280, 1024}},
+			{Name: "eDP-1", Geometry: Rect{0, 0, 1920, 1080}},
+		}
+	}
+
+	type placement struct {
+		ID      int64
+		Monitor string
+	}
+	tests := []struct {
+		name        string
+		monitors    []*Monitor
+		windows     []*Window
+		wantVisible []int64
+		wantPlaced  []placement
+		wantShown   map[string][]int64
+	}{{
+		name:     "in the gap of an L-shaped layout",
+		monitors: lShaped(),
+		windows: []*Window{
+			{ID: 1, Geometry: &Rect{0, 0, 1920, 360}},
+			{ID: 2, Geometry: &Rect{100, 400, 800, 600}},
+		},
+		wantVisible: []int64{2},
+		wantPlaced:  []placement{{1, ""}, {2, "eDP-1"}},
+		wantShown:   map[string][]int64{"eDP-1": {2}},
+	}, {
+		name:     "partly in the gap of an L-shaped layout",
+		monitors: lShaped(),
+		windows:  []*Window{{ID: 1, Geometry: &Rect{1000, 0, 800, 400}}},
+		// Only the bottom 40 pixels are on eDP-1.
+		wantVisible: []int64{1},
+		wantPlaced:  []placement{{1, "eDP-1"}},
+		wantShown:   map[string][]int64{"eDP-1": {1}},
+	}, {
+		name:     "straddling monitors",
+		monitors: lShaped(),
+		windows: []*Window{
+			{ID: 1, Geometry: &Rect{1520, 400, 600, 400}},
+			{ID: 2, Geometry: &Rect{1820, 400, 600, 400}},
+		},
+		wantVisible: []int64{1, 2},
+		wantPlaced:  []placement{{1, "eDP-1"}, {2, "DP-1"}},
+		wantShown:   map[string][]int64{"eDP-1": {1, 2}, "DP-1": {1, 2}},
+	}, {
+		name:     "negative offsets",
+		monitors: leftOfPrimary(),
+		windows: []*Window{
+			{ID: 1, Geometry: &Rect{-1000, 100, 800, 600}},
+			{ID: 2, Geometry: &Rect{-300, -50, 800, 600}},
+			{ID: 3, Geometry: &Rect{-2000, 0, 640, 480}},
+			{ID: 4, Geometry: &Rect{-1280, 1024, 640, 480}},
+		},
+		wantVisible: []int64{1, 2},
+		wantPlaced:  []placement{{1, "HDMI-1"}, {2, "eDP-1"}, {3, ""}, {4, ""}},
+		wantShown:   map[string][]int64{"HDMI-1": {1, 2}, "eDP-1": {2}},
+	}, {
+		name:     "other desktops, sticky, and minimized windows",
+		monitors: leftOfPrimary(),
+		windows: []*Window{
+			{ID: 1, Desktop: 1, Geometry: &Rect{0, 0, 800, 600}},
+			{ID: 2, Desktop: -1, Geometry: &Rect{0, 0, 800, 600}},
+			{ID: 3, Geometry: &Rect{0, 0, 800, 600}, Minimized: true},
+			{ID: 4},
+		},
+		wantVisible: []int64{2},
+		wantPlaced:  []placement{{1, "eDP-1"}, {2, "eDP-1"}, {3, "eDP-1"}, {4, ""}},
+		wantShown:   map[string][]int64{"eDP-1": {2}},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snap := &Snapshot{Windows: test.windows, Visible: []int64{99}}
+			placeWindows(snap, test.monitors, 0)
+			if !reflect.DeepEqual(snap.Visible, test.wantVisible) {
+				t.Errorf("got visible windows %v, want %v", snap.Visible, test.wantVisible)
+			}
+			var placed []placement
+			for _, w := range snap.Windows {
+				placed = append(placed, placement{w.ID, w.Monitor})
+			}
+			if !reflect.DeepEqual(placed, test.wantPlaced) {
+				t.Errorf("got monitors %v, want %v", placed, test.wantPlaced)
+			}
+			shown := make(map[string][]int64)
+			for _, m := range snap.Monitors {
+				if m.Visible != nil {
+					shown[m.Name] = m.Visible
+				}
+			}
+			if !reflect.DeepEqual(shown, test.wantShown) {
+				t.Errorf("got windows on each monitor %v, want %v", shown, test.wantShown)
+			}
+		})
+	}
+}
+
+func TestParseXrandrMonitors(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want []*Monitor
+	}{{
+		name: "primary",
+		out: "Monitors: 2\n" +
+			" 0: +*eDP-1 1920/344x1080/193+0+0  eDP-1\n" +
+			" 1: +HDMI-1 2560/597x1440/336+1920+0  HDMI-1\n",
+		want: []*Monitor{
+			{Name: "eDP-1", Geometry: Rect{0, 0, 1920, 1080}},
+			{Name: "HDMI-1", Geometry: Rect{1920, 0, 2560, 1440}},
+		},
+	}, {
+		name: "negative positions",
+		out: "Monitors: 3\n" +
+			" 0: +*DP-1-1 2560/597x1440/336+0+0  DP-1-1\n" +
+			" 1: +HDMI-1 1280/338x1024/270+-1280+-200  HDMI-1\n" +
+			" 2: +DP-2 1080/530x1920/300+2560+-480  DP-2\n",
+		want: []*Monitor{
+			{Name: "DP-1-1", Geometry: Rect{0, 0, 2560, 1440}},
+			{Name: "HDMI-1", Geometry: Rect{-1280, -200, 1280, 1024}},
+			{Name: "DP-2", Geometry: Rect{2560, -480, 1080, 1920}},
+		},
+	}, {
+		name: "virtual monitor",
+		out: "Monitors: 2\n" +
+			" 0: +*eDP-1 1920/344x1080/193+0+0  eDP-1\n" +
+			" 1: left 1920/480x2160/540+1920+0  DP-1 DP-2\n",
+		want: []*Monitor{
+			{Name: "eDP-1", Geometry: Rect{0, 0, 1920, 1080}},
+			{Name: "left", Geometry: Rect{1920, 0, 1920, 2160}},
+		},
+	}, {
+		name: "none",
+		out:  "Monitors: 0\n",
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseXrandrMonitors(test.out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+	if _, err := parseXrandrMonitors(" 0: +*eDP-1 99999999999999999999/344x1080/193+0+0  eDP-1\n"); err == nil {
+		t.Error("got no error for an out of range width")
+	}
+}
+
+func TestUncoveredArea(t *testing.T) {
+	r := Rect{0, 0, 100, 100}
+	tests := []struct {
+		name   string
+		r      Rect
+		covers []Rect
+		want   int
+	}{
+		{name: "uncovered", r: r, want: 10000},
+		{name: "fully covered", r: r, covers: []Rect{{-10, -10, 200, 200}}, want: 0},
+		{name: "covered by adjacent windows", r: r, covers: []Rect{{0, 0, 50, 100}, {50, 0, 50, 100}}, want: 0},
+		{name: "partly covered", r: r, covers: []Rect{{50, 50, 100, 100}}, want: 7500},
+		// The two covers overlap in a 25x25 square, which must
+		// only be subtracted once.
+		{name: "overlapping covers", r: r, covers: []Rect{{0, 0, 50, 50}, {25, 25, 50, 50}}, want: 10000 - 2500 - 2500 + 625},
+		{name: "covered in the middle", r: r, covers: []Rect{{25, 25, 50, 50}, {40, 0, 20, 100}}, want: 10000 - 2500 - 2*20*25},
+		{name: "cover outside", r: r, covers: []Rect{{100, 0, 50, 50}, {-50, -50, 50, 50}}, want: 10000},
+		{name: "empty", r: Rect{10, 10, 0, 100}, covers: []Rect{{0, 0, 5, 5}}, want: 0},
+		{name: "negative offsets", r: Rect{-100, -100, 100, 100}, covers: []Rect{{-150, -50, 100, 100}}, want: 10000 - 50*50},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := uncoveredArea(test.r, test.covers); got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSetVisibleFractions(t *testing.T) {
+	screen := []*Monitor{{Name: "eDP-1", Geometry: Rect{0, 0, 1000, 1000}}}
+	tests := []struct {
+		name     string
+		monitors []*Monitor
+		windows  []*Window
+		visible  []int64
+		stacking []int64
+		want     map[int64]float64
+	}{{
+		name:     "fully covered",
+		monitors: screen,
+		windows: []*Window{
+			{ID: 1, Geometry: &Rect{100, 100, 200, 200}},
+			{ID: 2, Geometry: &Rect{0, 0, 1000, 1000}},
+		},
+		visible:  []int64{1, 2},
+		stacking: []int64{1, 2},
+		want:     map[int64]float64{1: 0, 2: 1},
+	}, {
+		name:     "partly covered by overlapping windows",
+		monitors: screen,
+		windows: []*Window{
+			{ID: 1, Geometry: &Rect{0, 0, 1000, 1000}},
+			{ID: 2, Geometry: &Rect{0, 0, 500, 500}},
+			{ID: 3, Geometry: &Rect{250, 250, 500, 500}},
+		},
+		visible:  []int64{1, 2, 3},
+		stacking: []int64{1, 2, 3},
+		want:     map[int64]float64{1: 1 - float64(2*500*500-250*250)/(1000*1000), 2: 0.75, 3: 1},
+	}, {
+		name:     "covered by a window that isn't visible",
+		monitors: screen,
+		windows: []*Window{
+			{ID: 1, Geometry: &Rect{0, 0, 500, 500}},
+			{ID: 2, Geometry: &Rect{0, 0, 1000, 1000}, Minimized: true},
+			{ID: 3, Desktop: 1, Geometry: &Rect{0, 0, 1000, 1000}},
+		},
+		visible:  []int64{1},
+		stacking: []int64{1, 2, 3},
+		want:     map[int64]float64{1: 1},
+	}, {
+		name:     "partly off the monitors",
+		monitors: []*Monitor{{Geometry: Rect{0, 0, 1000, 1000}}, {Geometry: Rect{1000, 500, 1000, 1000}}},
+		windows: []*Window{
+			// Half on the first monitor, a quarter on the
+			// second, and a quarter in the gap above it.
+			{ID: 1, Geometry: &Rect{500, 0, 1000, 1000}},
+			{ID: 2, Geometry: &Rect{-500, 0, 1000, 1000}},
+		},
+		visible:  []int64{1, 2},
+		stacking: []int64{2, 1},
+		want:     map[int64]float64{1: 0.75, 2: 0.5},
+	}, {
+		name: "no monitors",
+		windows: []*Window{
+			{ID: 1, Geometry: &Rect{-500, 0, 1000, 1000}},
+			{ID: 2, Geometry: &Rect{0, 0, 100, 100}},
+		},
+		visible:  []int64{1, 2},
+		stacking: []int64{1, 2},
+		want:     map[int64]float64{1: 0.99, 2: 1},
+	}, {
+		name:     "missing from the stacking order",
+		monitors: screen,
+		windows: []*Window{
+			{ID: 1, Geometry: &Rect{0, 0, 1000, 1000}},
+			{ID: 2, Geometry: &Rect{0, 0, 500, 500}},
+			{ID: 3},
+		},
+		visible:  []int64{1, 2, 3},
+		stacking: []int64{1, 3, 99},
+		want:     map[int64]float64{1: 1},
+	}, {
+		name:     "no stacking order",
+		monitors: screen,
+		windows:  []*Window{{ID: 1, Geometry: &Rect{0, 0, 1000, 1000}}},
+		visible:  []int64{1},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snap := &Snapshot{Windows: test.windows, Visible: test.visible, Monitors: test.monitors}
+			setVisibleFractions(snap, test.stacking)
+			if !reflect.DeepEqual(snap.VisibleFraction, test.want) {
+				t.Errorf("got %v, want %v", snap.VisibleFraction, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package thyme
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+func init() {
+	RegisterTracker("gnome", NewGnomeTracker)
+}
+
+// GnomeTracker tracks application usage in GNOME Shell, including Wayland sessions, where GNOME doesn't let other
+// clients list its windows. It queries a companion GNOME Shell extension (in contrib/gnome-shell) over the session
+// D-Bus.
+type GnomeTracker struct{}
+
+var _ Tracker = (*GnomeTracker)(nil)
+
+func NewGnomeTracker() Tracker {
+	return &GnomeTracker{}
+}
+
+func (t *GnomeTracker) Capabilities() Capabilities {
+	return Capabilities{Visibility: true}
+}
+
+func (t *GnomeTracker) Deps() string {
+	return `
+Install and enable the Thyme GNOME Shell extension, which is in the contrib/gnome-shell directory of the Thyme
+source tree:
+
+  cp -r contrib/gnome-shell/thyme@sourcegraph.com ~/.local/share/gnome-shell/extensions/
+  gnome-extensions enable thyme@sourcegraph.com
+
+On Wayland, you will need to log out and back in before GNOME Shell loads the extension.
+
+Note: this command prints out this message regardless of whether the dependencies are already installed. Run
+"thyme dep --check" to check which ones are.
+`
+}
+
+func (t *GnomeTracker) CheckDeps() []*Dependency {
+	return []*Dependency{
+		checkProbe("GNOME session", func() error { return requireDesktop("GNOME") }, nil),
+		checkProbe("Thyme GNOME Shell extension", t.probeExtension, map[string]string{
+			"all": "cp -r contrib/gnome-shell/thyme@sourcegraph.com ~/.local/share/gnome-shell/extensions/ && gnome-extensions enable thyme@sourcegraph.com",
+		}),
+	}
+}
+
+func (t *GnomeTracker) Probe() error {
+	if err := requireDesktop("GNOME"); err != nil {
+		return err
+	}
+	return t.probeExtension()
+}
+
+// probeExtension returns a non-nil error unless the extension replies
+// within probeTimeout.
+func (t *GnomeTracker) probeExtension() error {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	_, err := t.windows(ctx)
+	return err
+}
+
+// The D-Bus object exported by the companion GNOME Shell extension.
+const (
+	gnomeBusName    = "org.gnome.Shell"
+	gnomeObjectPath = "/com/sourcegraph/Thyme"
+	gnomeInterface  = "com.sourcegraph.Thyme"
+)
+
+// gnomeWindows is the reply of the extension's Windows method.
+type gnomeWindows struct {
+	Windows []struct {
+		ID              int64  `json:"id"`
+		Title           string `json:"title"`
+		WMClass         string `json:"wm_class"`
+		WMClassInstance string `json:"wm_class_instance"`
+		Role            string `json:"role"`
+		PID             int64  `json:"pid"`
+		Rect            *Rect  `json:"rect"`
+		Fullscreen      bool   `json:"fullscreen"`
+		Maximized       bool   `json:"maximized"`
+		Workspace       int64  `json:"workspace"`
+		Focus           bool   `json:"focus"`
+		Visible         bool   `json:"visible"`
+	} `json:"windows"`
+	Workspaces []struct {
+		Index int64  `json:"index"`
+		Name  string `json:"name"`
+	} `json:"workspaces"`
+	CurrentWorkspace int64 `json:"current_workspace"`
+}
+
+func (t *GnomeTracker) Snap(ctx context.Context) (*Snapshot, error) {
+	reply, err := t.windows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snap := gnomeSnapshot(reply)
+	snap.Time = time.Now()
+	setVisibleFractions(snap, gnomeStacking(reply))
+	return snap, nil
+}
+
+// windows calls the extension's Windows method.
+func (t *GnomeTracker) windows(ctx context.Context) (*gnomeWindows, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to the session D-Bus: %s", err)
+	}
+	var out string
+	if err := dbusCall(ctx, conn.Object(gnomeBusName, gnomeObjectPath), gnomeInterface+".Windows").Store(&out); err != nil {
+		return nil, fmt.Errorf("could not list windows from GNOME Shell: %s. Is the Thyme GNOME Shell extension enabled? Run `thyme dep` for instructions.", err)
+	}
+	var reply gnomeWindows
+	if err := json.Unmarshal([]byte(out), &reply); err != nil {
+		return nil, fmt.Errorf("could not parse window list from GNOME Shell %q: %s", out, err)
+	}
+	return &reply, nil
+}
+
+// gnomeStacking returns the IDs of the windows in reply, which the
+// extension lists from bottom to top.
+func gnomeStacking(reply *gnomeWindows) []int64 {
+	stacking := make([]int64, len(reply.Windows))
+	for i, gw := range reply.Windows {
+		stacking[i] = gw.ID
+	}
+	return stacking
+}
+
+// gnomeSnapshot converts the reply of the extension's Windows method
+// into a Snapshot.
+func gnomeSnapshot(reply *gnomeWindows) *Snapshot {
+	var snap Snapshot
+	for _, ws := range reply.Workspaces {
+		snap.Desktops = append(snap.Desktops, &Desktop{ID: ws.Index, Name: ws.Name})
+	}
+	snap.CurrentDesktop = &reply.CurrentWorkspace
+	for _, gw := range reply.Windows {
+		w := Window{
+			ID:         gw.ID,
+			Desktop:    gw.Workspace,
+			Name:       gw.Title,
+			Class:      gw.WMClass,
+			Instance:   gw.WMClassInstance,
+			Role:       gw.Role,
+			Geometry:   gw.Rect,
+			Fullscreen: gw.Fullscreen,
+			Maximized:  gw.Maximized,
+		}
+		if gw.PID > 0 {
+			w.PID = gw.PID
+			w.Exe = processExe(gw.PID)
+		}
+		if w.IsSystem() {
+			continue
+		}
+		snap.Windows = append(snap.Windows, &w)
+		if gw.Focus {
+			snap.Active = w.ID
+		}
+		if gw.Visible {
+			snap.Visible = append(snap.Visible, w.ID)
+		}
+	}
+	return &snap
+}
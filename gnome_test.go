@@ -0,0 +1,151 @@
+package thyme
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// fakeGnomeShell stands in for the Thyme GNOME Shell extension.
+type fakeGnomeShell struct {
+	windows string
+	// hang, if non-nil, makes Windows wait until it is closed.
+	hang chan struct{}
+}
+
+func (s *fakeGnomeShell) Windows() (string, *dbus.Error) {
+	if s.hang != nil {
+		<-s.hang
+	}
+	return s.windows, nil
+}
+
+func TestGnomeTracker(t *testing.T) {
+	windows, err := ioutil.ReadFile(filepath.Join("testdata", "gnome", "windows.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := sessionConn(t, gnomeBusName)
+	if err := conn.Export(&fakeGnomeShell{windows: string(windows)}, gnomeObjectPath, gnomeInterface); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := NewGnomeTracker().Snap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Window{
+		{ID: 2286063571, Desktop: 1, Name: "Downloads", Class: "org.gnome.Nautilus", Instance: "org.gnome.Nautilus", PID: 3101, Geometry: &Rect{0, 32, 1920, 1048}, Maximized: true},
+		{ID: 2286063574, Desktop: 0, Name: "Mozilla Firefox", Class: "firefox", Instance: "Navigator", Role: "browser", PID: 3202, Geometry: &Rect{0, 32, 1920, 1048}, Maximized: true},
+		{ID: 2286063577, Desktop: 0, Name: "user@thinkpad: ~/src/thyme", Class: "org.gnome.Terminal", Instance: "gnome-terminal-server", Role: "gnome-terminal-window-8a1f", PID: 3303, Geometry: &Rect{960, 32, 960, 1048}},
+		{ID: 2286063580, Desktop: -1, Name: "Picture-in-Picture", Class: "firefox", Instance: "Toolkit", PID: 3202, Geometry: &Rect{1600, 800, 320, 180}},
+		{ID: 2286063583, Desktop: 0, Name: "Rhythmbox", Class: "Rhythmbox", Instance: "rhythmbox", PID: 3404, Geometry: &Rect{0, 32, 1920, 1048}, Maximized: true},
+	}
+	if !reflect.DeepEqual(withoutExe(snap.Windows), want) {
+		t.Errorf("got windows\n%s\nwant\n%s", windowsString(snap.Windows), windowsString(want))
+	}
+	if snap.Active != 2286063577 {
+		t.Errorf("got active window %d, want 2286063577", snap.Active)
+	}
+	if want := []int64{2286063574, 2286063577, 2286063580}; !reflect.DeepEqual(snap.Visible, want) {
+		t.Errorf("got visible windows %v, want %v", snap.Visible, want)
+	}
+	if snap.CurrentDesktop == nil || *snap.CurrentDesktop != 0 {
+		t.Errorf("got current desktop %v, want 0", snap.CurrentDesktop)
+	}
+	if want := []*Desktop{{ID: 0, Name: "Workspace 1"}, {ID: 1, Name: "Files"}}; !reflect.DeepEqual(snap.Desktops, want) {
+		t.Errorf("got desktops %+v, want %+v", snap.Desktops, want)
+	}
+
+	// The extension lists windows from bottom to top. The minimized
+	// window on top doesn't cover the others.
+	wantFractions := map[int64]float64{
+		2286063574: 0.5,
+		2286063577: 1 - float64(320*180)/(960*1048),
+		2286063580: 1,
+	}
+	if !reflect.DeepEqual(snap.VisibleFraction, wantFractions) {
+		t.Errorf("got visible fractions %v, want %v", snap.VisibleFraction, wantFractions)
+	}
+}
+
+func TestGnomeTrackerNoExtension(t *testing.T) {
+	startSessionBus(t)
+	if _, err := NewGnomeTracker().Snap(context.Background()); err == nil {
+		t.Error("got no error without the GNOME Shell extension")
+	}
+}
+
+func TestGnomeTrackerCanceled(t *testing.T) {
+	shell := &fakeGnomeShell{hang: make(chan struct{})}
+	defer close(shell.hang)
+	conn := sessionConn(t, gnomeBusName)
+	if err := conn.Export(shell, gnomeObjectPath, gnomeInterface); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewGnomeTracker().Snap(ctx)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("got no error from an extension that doesn't respond")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("snapshot didn't give up once its context was done")
+	}
+}
+
+func TestGnomeTrackerProbe(t *testing.T) {
+	defer func(timeout time.Duration) { probeTimeout = timeout }(probeTimeout)
+	probeTimeout = 100 * time.Millisecond
+
+	t.Setenv("XDG_CURRENT_DESKTOP", "KDE")
+	if err := NewGnomeTracker().(Prober).Probe(); err == nil {
+		t.Error("got no error outside of GNOME")
+	}
+	t.Setenv("XDG_CURRENT_DESKTOP", "ubuntu:GNOME")
+	startSessionBus(t)
+	if err := NewGnomeTracker().(Prober).Probe(); err == nil {
+		t.Error("got no error without the GNOME Shell extension")
+	}
+
+	t.Run("extension", func(t *testing.T) {
+		conn := sessionConn(t, gnomeBusName)
+		if err := conn.Export(&fakeGnomeShell{windows: `{"windows": []}`}, gnomeObjectPath, gnomeInterface); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewGnomeTracker().(Prober).Probe(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("extension not responding", func(t *testing.T) {
+		shell := &fakeGnomeShell{hang: make(chan struct{})}
+		defer close(shell.hang)
+		conn := sessionConn(t, gnomeBusName)
+		if err := conn.Export(shell, gnomeObjectPath, gnomeInterface); err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- NewGnomeTracker().(Prober).Probe() }()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Error("got no error from an extension that doesn't respond")
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("probe didn't give up on an extension that doesn't respond")
+		}
+	})
+}
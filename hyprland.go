@@ -0,0 +1,255 @@
+package thyme
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterTracker("hyprland", NewHyprlandTracker)
+}
+
+// HyprlandTracker tracks application usage in the Hyprland Wayland compositor (https://hyprland.org) by querying
+// clients, workspaces, and monitors over Hyprland's request socket.
+type HyprlandTracker struct{}
+
+var _ Tracker = (*HyprlandTracker)(nil)
+
+func NewHyprlandTracker() Tracker {
+	return &HyprlandTracker{}
+}
+
+func (t *HyprlandTracker) Capabilities() Capabilities {
+	return Capabilities{Visibility: true}
+}
+
+func (t *HyprlandTracker) Deps() string {
+	return `
+No external programs are required, but Thyme must run inside a Hyprland session so that the
+HYPRLAND_INSTANCE_SIGNATURE environment variable identifies Hyprland's request socket.
+
+Note: this command prints out this message regardless of whether the dependencies are already installed. Run
+"thyme dep --check" to check which ones are.
+`
+}
+
+func (t *HyprlandTracker) CheckDeps() []*Dependency {
+	return []*Dependency{
+		checkProbe("Hyprland request socket", t.Probe, map[string]string{
+			"all": "run Thyme inside a Hyprland session",
+		}),
+	}
+}
+
+func (t *HyprlandTracker) Probe() error {
+	socket, err := hyprSocket()
+	if err != nil {
+		return err
+	}
+	return requireSocket(socket)
+}
+
+// hyprClient is a window as returned by the "clients" and
+// "activewindow" requests.
+type hyprClient struct {
+	Address   string `json:"address"`
+	Mapped    bool   `json:"mapped"`
+	Hidden    bool   `json:"hidden"`
+	Workspace struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"workspace"`
+	Monitor int64  `json:"monitor"`
+	Class   string `json:"class"`
+	Title   string `json:"title"`
+	Pinned  bool   `json:"pinned"`
+	PID     int64  `json:"pid"`
+	At      [2]int `json:"at"`
+	Size    [2]int `json:"size"`
+
+	Fullscreen hyprFullscreen `json:"fullscreen"`
+}
+
+// hyprFullscreen is the fullscreen state of a client. Hyprland 0.42
+// changed it from a boolean to a bit set, in which 1 means maximized
+// and 2 means fullscreen.
+type hyprFullscreen struct {
+	Fullscreen, Maximized bool
+}
+
+func (f *hyprFullscreen) UnmarshalJSON(data []byte) error {
+	var state int
+	if err := json.Unmarshal(data, &state); err == nil {
+		f.Fullscreen, f.Maximized = state&2 != 0, state&1 != 0
+		return nil
+	}
+	return json.Unmarshal(data, &f.Fullscreen)
+}
+
+// hyprWorkspace is a workspace as returned by the "workspaces"
+// request.
+type hyprWorkspace struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// hyprMonitor is a monitor as returned by the "monitors" request.
+type hyprMonitor struct {
+	ID              int64         `json:"id"`
+	Name            string        `json:"name"`
+	Focused         bool          `json:"focused"`
+	ActiveWorkspace hyprWorkspace `json:"activeWorkspace"`
+
+	// SpecialWorkspace has ID 0 unless a special workspace (e.g.,
+	// a scratchpad) is open on top of the active workspace.
+	SpecialWorkspace hyprWorkspace `json:"specialWorkspace"`
+}
+
+// hyprSocket returns the path of Hyprland's request socket.
+func hyprSocket() (string, error) {
+	sig := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
+	if sig == "" {
+		return "", fmt.Errorf("HYPRLAND_INSTANCE_SIGNATURE is not set. Is Hyprland running?")
+	}
+	// Hyprland 0.40 moved its sockets from /tmp to $XDG_RUNTIME_DIR.
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		path := filepath.Join(runtimeDir, "hypr", sig, ".socket.sock")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return filepath.Join("/tmp/hypr", sig, ".socket.sock"), nil
+}
+
+// hyprRequest sends a request for JSON output to the Hyprland request
+// socket at path and decodes the reply into v.
+func hyprRequest(ctx context.Context, path, request string, v interface{}) error {
+	conn, err := dialUnix(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("j/" + request)); err != nil {
+		return err
+	}
+	out, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(out, v); err != nil {
+		return fmt.Errorf("could not parse reply to %q request %q: %s", request, string(out), err)
+	}
+	return nil
+}
+
+func (t *HyprlandTracker) Snap(ctx context.Context) (*Snapshot, error) {
+	socket, err := hyprSocket()
+	if err != nil {
+		return nil, err
+	}
+	var clients []*hyprClient
+	var active hyprClient
+	var workspaces []*hyprWorkspace
+	var monitors []*hyprMonitor
+	for _, req := range []struct {
+		name string
+		v    interface{}
+	}{
+		{"clients", &clients},
+		{"activewindow", &active},
+		{"workspaces", &workspaces},
+		{"monitors", &monitors},
+	} {
+		if err := hyprRequest(ctx, socket, req.name, req.v); err != nil {
+			return nil, fmt.Errorf("Hyprland %q request failed with error: %s. Try running `hyprctl -j %s` to diagnose.", req.name, err, req.name)
+		}
+	}
+	snap, err := hyprSnapshot(clients, &active, workspaces, monitors)
+	if err != nil {
+		return nil, err
+	}
+	snap.Time = time.Now()
+	return snap, nil
+}
+
+// hyprSnapshot converts the replies to Hyprland's "clients",
+// "activewindow", "workspaces", and "monitors" requests into a
+// Snapshot.
+func hyprSnapshot(clients []*hyprClient, active *hyprClient, workspaces []*hyprWorkspace, monitors []*hyprMonitor) (*Snapshot, error) {
+	var snap Snapshot
+	monitorNames := make(map[int64]string)
+	visibleWorkspaces := make(map[int64]bool)
+	for _, m := range monitors {
+		monitorNames[m.ID] = m.Name
+		visibleWorkspaces[m.ActiveWorkspace.ID] = true
+		if m.SpecialWorkspace.ID != 0 {
+			visibleWorkspaces[m.SpecialWorkspace.ID] = true
+		}
+		if m.Focused {
+			current := m.ActiveWorkspace.ID
+			snap.CurrentDesktop = &current
+		}
+	}
+
+	for _, ws := range workspaces {
+		snap.Desktops = append(snap.Desktops, &Desktop{ID: ws.ID, Name: ws.Name})
+	}
+	for _, c := range clients {
+		if !c.Mapped {
+			continue
+		}
+		id, err := hyprAddress(c.Address)
+		if err != nil {
+			return nil, err
+		}
+		w := Window{
+			ID:         id,
+			Desktop:    c.Workspace.ID,
+			Name:       c.Title,
+			Class:      c.Class,
+			Monitor:    monitorNames[c.Monitor],
+			Geometry:   &Rect{X: c.At[0], Y: c.At[1], Width: c.Size[0], Height: c.Size[1]},
+			Fullscreen: c.Fullscreen.Fullscreen,
+			Maximized:  c.Fullscreen.Maximized,
+		}
+		if c.PID > 0 {
+			w.PID = c.PID
+			w.Exe = processExe(c.PID)
+		}
+		if c.Pinned {
+			w.Desktop = -1
+		}
+		if w.IsSystem() {
+			continue
+		}
+		snap.Windows = append(snap.Windows, &w)
+		if !c.Hidden && (c.Pinned || visibleWorkspaces[c.Workspace.ID]) {
+			snap.Visible = append(snap.Visible, w.ID)
+		}
+	}
+	if active.Address != "" {
+		id, err := hyprAddress(active.Address)
+		if err != nil {
+			return nil, err
+		}
+		snap.Active = id
+	}
+	return &snap, nil
+}
+
+// hyprAddress parses a Hyprland window address (e.g., "0x55d7c1a0")
+// into a window ID.
+func hyprAddress(addr string) (int64, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(addr, "0x"), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse Hyprland window address %q: %s", addr, err)
+	}
+	return id, nil
+}
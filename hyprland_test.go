@@ -0,0 +1,131 @@
+package thyme
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// startHyprServer serves Hyprland's request socket for the duration of
+// the test, replying to each request for JSON output with the file of
+// the same name in testdata/hyprland, and points the environment at
+// it.
+func startHyprServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "thyme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	const sig = "0a1b2c3d_1700000000_123456789"
+	if err := os.MkdirAll(filepath.Join(dir, "hypr", sig), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	t.Setenv("HYPRLAND_INSTANCE_SIGNATURE", sig)
+
+	l, err := net.Listen("unix", filepath.Join(dir, "hypr", sig, ".socket.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 1024)
+				n, err := conn.Read(buf)
+				if err != nil {
+					return
+				}
+				request := strings.TrimPrefix(string(buf[:n]), "j/")
+				reply, err := ioutil.ReadFile(filepath.Join("testdata", "hyprland", request+".json"))
+				if err != nil {
+					reply = []byte("unknown request")
+				}
+				conn.Write(reply)
+			}()
+		}
+	}()
+}
+
+func TestHyprlandTracker(t *testing.T) {
+	startHyprServer(t)
+	snap, err := NewHyprlandTracker().Snap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The unmapped client is left out.
+	want := []*Window{
+		{ID: 0x55d7c1a0b2c0, Desktop: 1, Name: "~/src/thyme", Class: "kitty", PID: 2101, Monitor: "eDP-1", Geometry: &Rect{10, 50, 940, 1020}},
+		{ID: 0x55d7c1a3e7d0, Desktop: 1, Name: "htop", Class: "kitty", PID: 2102, Monitor: "eDP-1", Geometry: &Rect{10, 50, 940, 1020}},
+		{ID: 0x55d7c1b01f40, Desktop: 1, Name: "Mozilla Firefox", Class: "firefox", PID: 2201, Monitor: "eDP-1", Geometry: &Rect{960, 50, 950, 1020}, Maximized: true},
+		{ID: 0x55d7c1c45a10, Desktop: 2, Name: "video.mkv - mpv", Class: "mpv", PID: 2301, Monitor: "HDMI-A-1", Geometry: &Rect{1920, 0, 2560, 1440}, Fullscreen: true},
+		{ID: 0x55d7c1d7e2b0, Desktop: 3, Name: "Inbox - Mozilla Thunderbird", Class: "thunderbird", PID: 2401, Monitor: "HDMI-A-1", Geometry: &Rect{1930, 50, 2540, 1380}},
+		{ID: 0x55d7c1e9c3a0, Desktop: -1, Name: "Volume Control", Class: "org.pulseaudio.pavucontrol", PID: 2501, Monitor: "HDMI-A-1", Geometry: &Rect{3680, 1040, 600, 400}},
+		{ID: 0x55d7c1f0d4e0, Desktop: -98, Name: "Passwords - KeePassXC", Class: "org.keepassxc.KeePassXC", PID: 2601, Monitor: "eDP-1", Geometry: &Rect{460, 240, 1000, 600}},
+	}
+	if !reflect.DeepEqual(withoutExe(snap.Windows), want) {
+		t.Errorf("got windows\n%s\nwant\n%s", windowsString(snap.Windows), windowsString(want))
+	}
+	if snap.Active != 0x55d7c1a0b2c0 {
+		t.Errorf("got active window %#x, want %#x", snap.Active, 0x55d7c1a0b2c0)
+	}
+	// The window hidden in a group isn't visible, the pinned window
+	// is even though its workspace isn't shown, and so is the
+	// scratchpad open on eDP-1.
+	if want := []int64{0x55d7c1a0b2c0, 0x55d7c1b01f40, 0x55d7c1c45a10, 0x55d7c1e9c3a0, 0x55d7c1f0d4e0}; !reflect.DeepEqual(snap.Visible, want) {
+		t.Errorf("got visible windows %#x, want %#x", snap.Visible, want)
+	}
+	if snap.CurrentDesktop == nil || *snap.CurrentDesktop != 1 {
+		t.Errorf("got current desktop %v, want 1", snap.CurrentDesktop)
+	}
+	if want := []*Desktop{{ID: 1, Name: "1"}, {ID: 2, Name: "2"}, {ID: 3, Name: "mail"}, {ID: -98, Name: "special:scratch"}}; !reflect.DeepEqual(snap.Desktops, want) {
+		t.Errorf("got desktops %+v, want %+v", snap.Desktops, want)
+	}
+}
+
+func TestHyprlandTrackerNoSignature(t *testing.T) {
+	t.Setenv("HYPRLAND_INSTANCE_SIGNATURE", "")
+	if _, err := NewHyprlandTracker().Snap(context.Background()); err == nil {
+		t.Error("got no error without HYPRLAND_INSTANCE_SIGNATURE")
+	}
+}
+
+func TestHyprFullscreen(t *testing.T) {
+	tests := []struct {
+		data string
+		want hyprFullscreen
+	}{
+		// Hyprland before 0.42.
+		{data: "false", want: hyprFullscreen{}},
+		{data: "true", want: hyprFullscreen{Fullscreen: true}},
+		// Hyprland 0.42 and later.
+		{data: "0", want: hyprFullscreen{}},
+		{data: "1", want: hyprFullscreen{Maximized: true}},
+		{data: "2", want: hyprFullscreen{Fullscreen: true}},
+		{data: "3", want: hyprFullscreen{Fullscreen: true, Maximized: true}},
+	}
+	for _, test := range tests {
+		var got hyprFullscreen
+		if err := json.Unmarshal([]byte(test.data), &got); err != nil {
+			t.Errorf("%s: %s", test.data, err)
+		} else if got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.data, got, test.want)
+		}
+	}
+	var f hyprFullscreen
+	if err := json.Unmarshal([]byte(`"yes"`), &f); err == nil {
+		t.Error("got no error for a string")
+	}
+}
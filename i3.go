@@ -0,0 +1,157 @@
+package thyme
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterTracker("i3", NewI3Tracker)
+}
+
+// I3Tracker tracks application usage in the i3 window manager (https://i3wm.org) by requesting the layout tree and
+// workspaces over i3's IPC socket. This gives it the same information as the trackers built on X11 utilities without
+// querying each window individually.
+type I3Tracker struct{}
+
+var _ Tracker = (*I3Tracker)(nil)
+
+func NewI3Tracker() Tracker {
+	return &I3Tracker{}
+}
+
+func (t *I3Tracker) Capabilities() Capabilities {
+	return Capabilities{Visibility: true}
+}
+
+func (t *I3Tracker) Deps() string {
+	return `
+No external programs are required, but Thyme must run inside an i3 session so that it can find i3's IPC socket
+(via the I3SOCK environment variable or ` + "`i3 --get-socketpath`" + `).
+
+Note: this command prints out this message regardless of whether the dependencies are already installed. Run
+"thyme dep --check" to check which ones are.
+`
+}
+
+func (t *I3Tracker) CheckDeps() []*Dependency {
+	return []*Dependency{
+		checkProbe("X11 session", requireX11, nil),
+		checkProbe("i3 IPC socket", t.Probe, map[string]string{
+			"all": "run Thyme inside an i3 session",
+		}),
+	}
+}
+
+func (t *I3Tracker) Probe() error {
+	if err := requireX11(); err != nil {
+		return err
+	}
+	socket, err := i3Socket(context.Background())
+	if err != nil {
+		return err
+	}
+	return requireSocket(socket)
+}
+
+// i3Socket returns the path of i3's IPC socket.
+func i3Socket(ctx context.Context) (string, error) {
+	if socket := os.Getenv("I3SOCK"); socket != "" {
+		return socket, nil
+	}
+	out, err := exec.CommandContext(ctx, "i3", "--get-socketpath").Output()
+	if err != nil {
+		return "", fmt.Errorf("I3SOCK is not set and `i3 --get-socketpath` failed with error: %s. Is i3 running?", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (t *I3Tracker) Snap(ctx context.Context) (*Snapshot, error) {
+	socket, err := i3Socket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tree ipcNode
+	if err := ipcRequest(ctx, socket, ipcGetTree, &tree); err != nil {
+		return nil, fmt.Errorf("i3 GET_TREE request failed with error: %s. Try running `i3-msg -t get_tree` to diagnose.", err)
+	}
+	var workspaces []*ipcWorkspace
+	if err := ipcRequest(ctx, socket, ipcGetWorkspaces, &workspaces); err != nil {
+		return nil, fmt.Errorf("i3 GET_WORKSPACES request failed with error: %s. Try running `i3-msg -t get_workspaces` to diagnose.", err)
+	}
+	snap := i3Snapshot(&tree, workspaces)
+	snap.Time = time.Now()
+	setVisibleFractions(snap, treeStacking(snap.Windows))
+	return snap, nil
+}
+
+// i3Snapshot converts an i3 layout tree and workspace list into a
+// Snapshot.
+func i3Snapshot(tree *ipcNode, workspaces []*ipcWorkspace) *Snapshot {
+	var snap Snapshot
+	visibleWorkspaces := make(map[string]bool)
+	outputs := make(map[string]string)
+	for _, ws := range workspaces {
+		if ws.Visible {
+			visibleWorkspaces[ws.Name] = true
+		}
+		if ws.Focused {
+			current := ws.desktop()
+			snap.CurrentDesktop = &current
+		}
+		outputs[ws.Name] = ws.Output
+	}
+
+	var walk func(n, workspace *ipcNode, visible bool)
+	walk = func(n, workspace *ipcNode, visible bool) {
+		if n.Type == "workspace" {
+			workspace = n
+			visible = visibleWorkspaces[n.Name]
+			if !strings.HasPrefix(n.Name, "__") {
+				// Names starting with "__" are reserved for
+				// i3's internal workspaces (e.g., the
+				// scratchpad).
+				snap.Desktops = append(snap.Desktops, &Desktop{ID: n.desktop(), Name: n.Name})
+			}
+		}
+		if n.isWindow() {
+			if n.Window == nil {
+				// Placeholder containers (e.g., from
+				// append_layout) have no window yet.
+				return
+			}
+			w := Window{ID: *n.Window, Desktop: -1, Name: n.Name}
+			if workspace != nil && !n.Sticky {
+				w.Desktop = workspace.desktop()
+			}
+			n.setAppInfo(&w)
+			n.setGeometry(&w)
+			if workspace != nil {
+				w.Monitor = outputs[workspace.Name]
+			}
+			if w.IsSystem() {
+				return
+			}
+			snap.Windows = append(snap.Windows, &w)
+			if n.Focused {
+				snap.Active = w.ID
+			}
+			if visible {
+				snap.Visible = append(snap.Visible, w.ID)
+			}
+			return
+		}
+		for _, child := range n.Nodes {
+			walk(child, workspace, visible && (n.showsAllChildren() || len(n.Focus) > 0 && n.Focus[0] == child.ID))
+		}
+		for _, child := range n.FloatingNodes {
+			walk(child, workspace, visible)
+		}
+	}
+	walk(tree, nil, true)
+	return &snap
+}
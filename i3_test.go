@@ -0,0 +1,91 @@
+package thyme
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestI3Tracker(t *testing.T) {
+	t.Setenv("I3SOCK", startIPCServer(t, map[uint32]string{
+		ipcGetTree:       filepath.Join("testdata", "i3", "tree.json"),
+		ipcGetWorkspaces: filepath.Join("testdata", "i3", "workspaces.json"),
+	}))
+	snap, err := NewI3Tracker().Snap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The placeholder container waiting to swallow a window is left
+	// out.
+	want := []*Window{
+		// The scratchpad is a workspace of its own, without a number,
+		// so it is identified by its node ID.
+		{ID: 23068675, Desktop: 94000000000011, Name: "Passwords - KeePassXC", Class: "KeePassXC", Instance: "keepassxc", Geometry: &Rect{560, 240, 800, 600}},
+		{ID: 20971523, Desktop: 1, Name: "~/src/thyme", Class: "URxvt", Instance: "urxvt", Monitor: "eDP-1", Geometry: &Rect{0, 0, 640, 1080}},
+		{ID: 14680067, Desktop: 1, Name: "Mozilla Firefox", Class: "firefox", Instance: "Navigator", Role: "browser", Monitor: "eDP-1", Geometry: &Rect{640, 20, 640, 1060}},
+		{ID: 14680099, Desktop: 1, Name: "i3: i3 User’s Guide", Class: "firefox", Instance: "Navigator", Role: "browser", Monitor: "eDP-1", Geometry: &Rect{640, 20, 640, 1060}},
+		{ID: 25165827, Desktop: 1, Name: "htop", Class: "URxvt", Instance: "urxvt", Monitor: "eDP-1", Geometry: &Rect{1280, 40, 640, 520}},
+		{ID: 25165859, Desktop: 1, Name: "journalctl -f", Class: "URxvt", Instance: "urxvt", Monitor: "eDP-1", Geometry: &Rect{1280, 560, 640, 520}},
+		{ID: 27262979, Desktop: 1, Name: "Slack", Class: "Slack", Instance: "slack", Monitor: "eDP-1", Geometry: &Rect{1280, 40, 640, 1040}},
+		{ID: 29360131, Desktop: -1, Name: "xclock", Class: "XClock", Instance: "xclock", Monitor: "eDP-1", Geometry: &Rect{1720, 880, 200, 200}},
+		// Named workspaces without a number are identified by their
+		// node ID too.
+		{ID: 31457283, Desktop: 94000000000022, Name: "Inbox - Mozilla Thunderbird", Class: "Thunderbird", Instance: "Mail", Monitor: "eDP-1", Geometry: &Rect{0, 0, 1920, 1080}},
+	}
+	if !reflect.DeepEqual(snap.Windows, want) {
+		t.Errorf("got windows\n%s\nwant\n%s", windowsString(snap.Windows), windowsString(want))
+	}
+	if snap.Active != 20971523 {
+		t.Errorf("got active window %d, want 20971523", snap.Active)
+	}
+	// Only the focused child of the tabbed and stacked containers is
+	// visible, which for the stacked container is a split of two
+	// windows.
+	if want := []int64{20971523, 14680099, 25165827, 25165859, 29360131}; !reflect.DeepEqual(snap.Visible, want) {
+		t.Errorf("got visible windows %v, want %v", snap.Visible, want)
+	}
+	if snap.CurrentDesktop == nil || *snap.CurrentDesktop != 1 {
+		t.Errorf("got current desktop %v, want 1", snap.CurrentDesktop)
+	}
+	if want := []*Desktop{{ID: 1, Name: "1: code"}, {ID: 94000000000022, Name: "mail"}}; !reflect.DeepEqual(snap.Desktops, want) {
+		t.Errorf("got desktops %+v, want %+v", snap.Desktops, want)
+	}
+	// The floating xclock covers part of journalctl.
+	if got, want := snap.VisibleFraction[25165859], 1-float64(200*200)/(640*520); got != want {
+		t.Errorf("got visible fraction %v for the window under xclock, want %v", got, want)
+	}
+}
+
+func TestI3SnapshotVisibility(t *testing.T) {
+	window := func(id int64) *ipcNode {
+		return &ipcNode{ID: id, Type: "con", Window: &id}
+	}
+	tests := []struct {
+		name   string
+		layout string
+		focus  []int64
+		want   []int64
+	}{
+		{name: "splith", layout: "splith", focus: []int64{2, 1}, want: []int64{1, 2}},
+		{name: "splitv", layout: "splitv", want: []int64{1, 2}},
+		{name: "tabbed", layout: "tabbed", focus: []int64{2, 1}, want: []int64{2}},
+		{name: "stacked", layout: "stacked", focus: []int64{1, 2}, want: []int64{1}},
+		{name: "tabbed without focus", layout: "tabbed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := &ipcNode{Type: "workspace", Name: "1", Num: 1, Nodes: []*ipcNode{
+				{ID: 10, Type: "con", Layout: test.layout, Focus: test.focus, Nodes: []*ipcNode{window(1), window(2)}},
+			}}
+			snap := i3Snapshot(tree, []*ipcWorkspace{{Num: 1, Name: "1", Visible: true}})
+			if len(snap.Windows) != 2 {
+				t.Errorf("got windows\n%s", windowsString(snap.Windows))
+			}
+			if !reflect.DeepEqual(snap.Visible, test.want) {
+				t.Errorf("got visible windows %v, want %v", snap.Visible, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package thyme
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+)
+
+// The i3 IPC protocol, which sway also speaks, frames every message
+// with a magic string, the payload length, and the message type. See
+// https://i3wm.org/docs/ipc.html for details.
+const (
+	ipcMagic = "i3-ipc"
+
+	ipcGetWorkspaces = 1
+	ipcGetOutputs    = 3
+	ipcGetTree       = 4
+)
+
+// ipcWorkspace is a workspace as returned by GET_WORKSPACES.
+type ipcWorkspace struct {
+	ID      int64  `json:"id"`
+	Num     int64  `json:"num"`
+	Name    string `json:"name"`
+	Visible bool   `json:"visible"`
+	Focused bool   `json:"focused"`
+	Output  string `json:"output"`
+}
+
+// ipcByteOrder is the byte order of the integers in the message
+// header. The protocol uses the host's byte order, which is little
+// endian on every platform i3 and sway run on in practice.
+var ipcByteOrder = binary.LittleEndian
+
+// dialUnix connects to the Unix socket at path. Reads and writes on
+// the connection fail once ctx's deadline, if any, has passed.
+func dialUnix(ctx context.Context, path string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// ipcRequest sends a message of type msgType to the i3 or sway IPC
+// socket at path and decodes the JSON reply into v.
+func ipcRequest(ctx context.Context, path string, msgType uint32, v interface{}) error {
+	conn, err := dialUnix(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	header := make([]byte, len(ipcMagic)+8)
+	copy(header, ipcMagic)
+	ipcByteOrder.PutUint32(header[len(ipcMagic):], 0)
+	ipcByteOrder.PutUint32(header[len(ipcMagic)+4:], msgType)
+	if _, err := conn.Write(header); err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("could not read IPC reply header: %s", err)
+	}
+	if string(header[:len(ipcMagic)]) != ipcMagic {
+		return fmt.Errorf("invalid IPC reply: bad magic string %q", header[:len(ipcMagic)])
+	}
+	length := ipcByteOrder.Uint32(header[len(ipcMagic):])
+	if replyType := ipcByteOrder.Uint32(header[len(ipcMagic)+4:]); replyType != msgType {
+		return fmt.Errorf("invalid IPC reply: expected type %d, got %d", msgType, replyType)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return fmt.Errorf("could not read IPC reply payload: %s", err)
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// ipcNode is a node in the layout tree returned by GET_TREE. Only
+// the fields Thyme uses are included. Some fields are only set by
+// sway and others only by i3.
+type ipcNode struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Num     int64  `json:"num"`
+	Focused bool   `json:"focused"`
+	Sticky  bool   `json:"sticky"`
+
+	// Visible is only set by sway.
+	Visible *bool `json:"visible"`
+
+	// AppID is the Wayland app_id. It is only set by sway, and is
+	// null for Xwayland windows.
+	AppID *string `json:"app_id"`
+
+	// Window is the X11 window ID, for windows that have one.
+	Window *int64 `json:"window"`
+
+	// WindowProperties holds the ICCCM properties of X11 windows.
+	WindowProperties *ipcWindowProperties `json:"window_properties"`
+
+	// PID is the ID of the process that owns the window. It is only
+	// set by sway.
+	PID int64 `json:"pid"`
+
+	// Rect is the absolute position and size of the node.
+	Rect *Rect `json:"rect"`
+
+	// FullscreenMode is 0 if the node isn't fullscreen, 1 if it is
+	// fullscreen on its output, and 2 if it is fullscreen across all
+	// outputs.
+	FullscreenMode int `json:"fullscreen_mode"`
+
+	// Output is the name of the output a workspace is on. It is only
+	// set by sway; i3 reports it in GET_WORKSPACES instead.
+	Output string `json:"output"`
+
+	// Layout is how the node arranges its children (e.g.,
+	// "splith" or "tabbed").
+	Layout string `json:"layout"`
+
+	// Focus lists the IDs of the node's children, most recently
+	// focused first.
+	Focus []int64 `json:"focus"`
+
+	Nodes         []*ipcNode `json:"nodes"`
+	FloatingNodes []*ipcNode `json:"floating_nodes"`
+}
+
+// ipcWindowProperties are the ICCCM properties of an X11 window.
+type ipcWindowProperties struct {
+	Class    string `json:"class"`
+	Instance string `json:"instance"`
+	Role     string `json:"window_role"`
+}
+
+// setAppInfo fills in the class, instance, role, and process of w
+// from the node n.
+func (n *ipcNode) setAppInfo(w *Window) {
+	if p := n.WindowProperties; p != nil {
+		w.Class, w.Instance, w.Role = p.Class, p.Instance, p.Role
+	}
+	if n.AppID != nil && *n.AppID != "" {
+		w.Class = *n.AppID
+	}
+	if n.PID > 0 {
+		w.PID = n.PID
+		w.Exe = processExe(n.PID)
+	}
+}
+
+// setGeometry fills in the geometry and fullscreen state of w from
+// the node n.
+func (n *ipcNode) setGeometry(w *Window) {
+	w.Geometry = n.Rect
+	w.Fullscreen = n.FullscreenMode != 0
+}
+
+// isWindow returns true if the node is an application window (as
+// opposed to an output, workspace, or split container).
+func (n *ipcNode) isWindow() bool {
+	return (n.Type == "con" || n.Type == "floating_con") && len(n.Nodes) == 0 && len(n.FloatingNodes) == 0
+}
+
+// showsAllChildren returns true if all of the node's children are
+// displayed at once, rather than only the focused one (as in tabbed
+// and stacked containers).
+func (n *ipcNode) showsAllChildren() bool {
+	return n.Layout != "tabbed" && n.Layout != "stacked"
+}
+
+// desktop returns the Window.Desktop value for windows on the
+// workspace n. Workspaces are identified by number where they have
+// one; named workspaces without a number have num -1, so they are
+// identified by their node ID instead.
+func (n *ipcNode) desktop() int64 {
+	if n.Num >= 0 {
+		return n.Num
+	}
+	return n.ID
+}
+
+// desktop returns the Window.Desktop value for windows on the
+// workspace ws, like ipcNode.desktop does for workspace nodes.
+func (ws *ipcWorkspace) desktop() int64 {
+	if ws.Num >= 0 {
+		return ws.Num
+	}
+	return ws.ID
+}
+
+// walk calls f for every window in the tree rooted at n, along with
+// the workspace that contains it (nil for windows outside of any
+// workspace).
+func (n *ipcNode) walk(workspace *ipcNode, f func(win, workspace *ipcNode)) {
+	if n.Type == "workspace" {
+		workspace = n
+	}
+	if n.isWindow() {
+		f(n, workspace)
+		return
+	}
+	for _, child := range n.Nodes {
+		child.walk(workspace, f)
+	}
+	for _, child := range n.FloatingNodes {
+		child.walk(workspace, f)
+	}
+}
+
+// treeStacking returns the IDs of windows, which must be in the order
+// of the layout tree, from bottom to top. Floating windows come after
+// tiled ones in the tree, so they are already above them; fullscreen
+// windows are moved above all others.
+func treeStacking(windows []*Window) []int64 {
+	var stacking, fullscreen []int64
+	for _, w := range windows {
+		if w.Fullscreen {
+			fullscreen = append(fullscreen, w.ID)
+		} else {
+			stacking = append(stacking, w.ID)
+		}
+	}
+	return append(stacking, fullscreen...)
+}
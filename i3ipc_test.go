@@ -0,0 +1,124 @@
+package thyme
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// startIPCServer serves the i3 IPC protocol on a Unix socket for the
+// duration of the test and returns the socket's path. It replies to
+// each message type in replies with the contents of the corresponding
+// file, and closes the connection on any other message.
+func startIPCServer(t *testing.T, replies map[uint32]string) string {
+	payloads := make(map[uint32][]byte)
+	for msgType, file := range replies {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payloads[msgType] = data
+	}
+
+	dir, err := ioutil.TempDir("", "thyme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "ipc.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveIPC(conn, payloads)
+		}
+	}()
+	return path
+}
+
+func serveIPC(conn net.Conn, payloads map[uint32][]byte) {
+	defer conn.Close()
+	header := make([]byte, len(ipcMagic)+8)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		if string(header[:len(ipcMagic)]) != ipcMagic {
+			return
+		}
+		length := ipcByteOrder.Uint32(header[len(ipcMagic):])
+		if _, err := io.CopyN(ioutil.Discard, conn, int64(length)); err != nil {
+			return
+		}
+		payload, ok := payloads[ipcByteOrder.Uint32(header[len(ipcMagic)+4:])]
+		if !ok {
+			return
+		}
+		ipcByteOrder.PutUint32(header[len(ipcMagic):], uint32(len(payload)))
+		if _, err := conn.Write(append(header, payload...)); err != nil {
+			return
+		}
+	}
+}
+
+func TestIPCNodeSetAppInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		node string
+		want Window
+	}{
+		{
+			name: "Wayland window",
+			node: `{"app_id": "org.gnome.Nautilus", "pid": 3101}`,
+			want: Window{Class: "org.gnome.Nautilus", PID: 3101},
+		},
+		{
+			name: "Xwayland window",
+			node: `{"app_id": null, "window_properties": {"class": "Firefox", "instance": "Navigator", "window_role": "browser"}}`,
+			want: Window{Class: "Firefox", Instance: "Navigator", Role: "browser"},
+		},
+		{
+			// The app_id is preferred, but the instance and role are
+			// still taken from the window properties.
+			name: "app_id and window properties",
+			node: `{"app_id": "firefox", "window_properties": {"class": "Firefox", "instance": "Navigator", "window_role": "browser"}}`,
+			want: Window{Class: "firefox", Instance: "Navigator", Role: "browser"},
+		},
+		{
+			name: "empty app_id",
+			node: `{"app_id": "", "window_properties": {"class": "XTerm", "instance": "xterm"}}`,
+			want: Window{Class: "XTerm", Instance: "xterm"},
+		},
+		{
+			name: "neither",
+			node: `{}`,
+			want: Window{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var n ipcNode
+			if err := json.Unmarshal([]byte(test.node), &n); err != nil {
+				t.Fatal(err)
+			}
+			w := &Window{}
+			n.setAppInfo(w)
+			if got := withoutExe([]*Window{w})[0]; !reflect.DeepEqual(*got, test.want) {
+				t.Errorf("got %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+}
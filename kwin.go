@@ -0,0 +1,324 @@
+package thyme
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+func init() {
+	RegisterTracker("kwin", NewKWinTracker)
+}
+
+// KWinTracker tracks application usage in KDE Plasma's KWin window manager, on both X11 and Wayland. For each
+// snapshot, it loads a short KWin script over the session D-Bus that collects the window list and reports it back to
+// the tracker over D-Bus.
+type KWinTracker struct{}
+
+var _ Tracker = (*KWinTracker)(nil)
+
+func NewKWinTracker() Tracker {
+	return &KWinTracker{}
+}
+
+func (t *KWinTracker) Capabilities() Capabilities {
+	return Capabilities{Visibility: true}
+}
+
+func (t *KWinTracker) Deps() string {
+	return `
+No external programs are required, but Thyme must run inside a KDE Plasma session so that it can reach KWin over
+the session D-Bus.
+
+Note: this command prints out this message regardless of whether the dependencies are already installed. Run
+"thyme dep --check" to check which ones are.
+`
+}
+
+func (t *KWinTracker) CheckDeps() []*Dependency {
+	return []*Dependency{
+		checkProbe("KWin D-Bus service", t.Probe, map[string]string{
+			"all": "run Thyme inside a KDE Plasma session",
+		}),
+	}
+}
+
+func (t *KWinTracker) Probe() error {
+	if err := requireDesktop("KDE"); err != nil {
+		return err
+	}
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return fmt.Errorf("could not connect to the session D-Bus: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	var running bool
+	if err := dbusCall(ctx, conn.BusObject(), "org.freedesktop.DBus.NameHasOwner", "org.kde.KWin").Store(&running); err != nil {
+		return err
+	}
+	if !running {
+		return fmt.Errorf("KWin is not running")
+	}
+	return nil
+}
+
+// The D-Bus object the KWin script reports back to.
+const (
+	kwinReceiverPath  = "/com/sourcegraph/Thyme/KWin"
+	kwinReceiverIface = "com.sourcegraph.Thyme"
+)
+
+// kwinTimeout is the longest to wait for the KWin script to report
+// back, in case it fails without reporting at all.
+var kwinTimeout = 5 * time.Second
+
+// kwinScript is the KWin script that reports the window list. It
+// supports both the Plasma 5 and Plasma 6 scripting APIs. Before the
+// script is loaded, the placeholders are replaced with the D-Bus name
+// of the tracker's connection and the script's token (see
+// kwinReceiver).
+const kwinScript = `
+(function () {
+    var plasma6 = typeof workspace.windowList === "function";
+    var windows = plasma6 ? workspace.windowList() : workspace.clientList();
+    var active = plasma6 ? workspace.activeWindow : workspace.activeClient;
+
+    // Desktops are numbered from 0, like wmctrl does.
+    var current, desktops = [];
+    if (plasma6) {
+        current = workspace.currentDesktop.x11DesktopNumber - 1;
+        for (var i = 0; i < workspace.desktops.length; i++) {
+            var d = workspace.desktops[i];
+            desktops.push({id: d.x11DesktopNumber - 1, name: d.name});
+        }
+    } else {
+        current = workspace.currentDesktop - 1;
+        for (var i = 1; i <= workspace.desktops; i++) {
+            desktops.push({id: i - 1, name: workspace.desktopName(i)});
+        }
+    }
+
+    // stackingOrder lists windows from bottom to top. Older versions
+    // of KWin don't provide it.
+    var stacking = [], stackingOrder = workspace.stackingOrder || [];
+    for (var i = 0; i < stackingOrder.length; i++) {
+        stacking.push(String(stackingOrder[i].internalId));
+    }
+
+    var out = {windows: [], desktops: desktops, current_desktop: current, stacking: stacking};
+    for (var i = 0; i < windows.length; i++) {
+        var w = windows[i];
+        if (!w.normalWindow && !w.dialog) {
+            continue;
+        }
+        var desktop = -1;
+        if (!w.onAllDesktops) {
+            desktop = plasma6 ? (w.desktops.length > 0 ? w.desktops[0].x11DesktopNumber - 1 : -1) : w.desktop - 1;
+        }
+        out.windows.push({
+            id: String(w.internalId),
+            caption: w.caption,
+            resource_class: String(w.resourceClass),
+            resource_name: String(w.resourceName || ""),
+            role: String(w.windowRole || ""),
+            pid: w.pid,
+            rect: {x: w.frameGeometry.x, y: w.frameGeometry.y, width: w.frameGeometry.width, height: w.frameGeometry.height},
+            fullscreen: w.fullScreen,
+            output: plasma6 && w.output ? w.output.name : "",
+            desktop: desktop,
+            minimized: w.minimized,
+            active: w === active
+        });
+    }
+    callDBus("` + kwinBusNamePlaceholder + `", "` + kwinReceiverPath + `", "` + kwinReceiverIface + `", "Report",
+        "` + kwinTokenPlaceholder + `", JSON.stringify(out));
+})();
+`
+
+// The placeholders in kwinScript.
+const (
+	kwinBusNamePlaceholder = "THYME_BUS_NAME"
+	kwinTokenPlaceholder   = "THYME_TOKEN"
+)
+
+// kwinWindows is the report sent by kwinScript.
+type kwinWindows struct {
+	Windows []struct {
+		ID            string `json:"id"`
+		Caption       string `json:"caption"`
+		ResourceClass string `json:"resource_class"`
+		ResourceName  string `json:"resource_name"`
+		Role          string `json:"role"`
+		PID           int64  `json:"pid"`
+		Rect          *Rect  `json:"rect"`
+		Fullscreen    bool   `json:"fullscreen"`
+		Output        string `json:"output"`
+		Desktop       int64  `json:"desktop"`
+		Minimized     bool   `json:"minimized"`
+		Active        bool   `json:"active"`
+	} `json:"windows"`
+	Desktops []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"desktops"`
+	CurrentDesktop int64    `json:"current_desktop"`
+	Stacking       []string `json:"stacking"`
+}
+
+// kwinReceiver is the D-Bus object that receives reports from
+// kwinScript. Each script is loaded with its own token, so that a
+// late report from an earlier script that timed out isn't mistaken
+// for the report of the current one.
+type kwinReceiver struct {
+	token   string
+	reports chan string
+}
+
+func (r *kwinReceiver) Report(token, report string) *dbus.Error {
+	if token != r.token {
+		return nil
+	}
+	select {
+	case r.reports <- report:
+	default:
+		// A report was already received (e.g., the script was
+		// run twice), so drop this one.
+	}
+	return nil
+}
+
+// kwinScriptCount makes the plugin name of each loaded script unique.
+var kwinScriptCount uint64
+
+func (t *KWinTracker) Snap(ctx context.Context) (*Snapshot, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to the session D-Bus: %s", err)
+	}
+	names := conn.Names()
+	if len(names) == 0 {
+		return nil, fmt.Errorf("session D-Bus connection has no name")
+	}
+
+	// The plugin name doubles as the script's token.
+	plugin := fmt.Sprintf("thyme-%d-%d", os.Getpid(), atomic.AddUint64(&kwinScriptCount, 1))
+	receiver := &kwinReceiver{token: plugin, reports: make(chan string, 1)}
+	if err := conn.Export(receiver, kwinReceiverPath, kwinReceiverIface); err != nil {
+		return nil, err
+	}
+	defer conn.Export(nil, kwinReceiverPath, kwinReceiverIface)
+
+	f, err := ioutil.TempFile("", "thyme-kwin-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	script := strings.NewReplacer(kwinBusNamePlaceholder, names[0], kwinTokenPlaceholder, plugin).Replace(kwinScript)
+	if _, err := f.WriteString(script); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	scripting := conn.Object("org.kde.KWin", "/Scripting")
+	var id int32
+	if err := dbusCall(ctx, scripting, "org.kde.kwin.Scripting.loadScript", f.Name(), plugin).Store(&id); err != nil {
+		return nil, fmt.Errorf("could not load KWin script: %s. Is KWin running?", err)
+	}
+	// Don't wait for the reply, so that cleaning up can't hang
+	// after ctx is done.
+	defer scripting.Go("org.kde.kwin.Scripting.unloadScript", dbus.FlagNoReplyExpected, nil, plugin)
+
+	// Newer versions of KWin export loaded scripts under /Scripting,
+	// older ones at the root.
+	loaded := conn.Object("org.kde.KWin", dbus.ObjectPath(fmt.Sprintf("/Scripting/Script%d", id)))
+	if err := dbusCall(ctx, loaded, "org.kde.kwin.Script.run").Err; err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		loaded = conn.Object("org.kde.KWin", dbus.ObjectPath(fmt.Sprintf("/%d", id)))
+		if err := dbusCall(ctx, loaded, "org.kde.kwin.Script.run").Err; err != nil {
+			return nil, fmt.Errorf("could not run KWin script: %s", err)
+		}
+	}
+
+	timer := time.NewTimer(kwinTimeout)
+	defer timer.Stop()
+	var report string
+	select {
+	case report = <-receiver.reports:
+	case <-timer.C:
+		return nil, fmt.Errorf("timed out waiting for the KWin script to report the window list")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var windows kwinWindows
+	if err := json.Unmarshal([]byte(report), &windows); err != nil {
+		return nil, fmt.Errorf("could not parse window list from KWin %q: %s", report, err)
+	}
+	snap := kwinSnapshot(&windows)
+	snap.Time = time.Now()
+	setVisibleFractions(snap, kwinStacking(&windows))
+	return snap, nil
+}
+
+// kwinStacking returns the IDs of the windows in the report sent by
+// kwinScript, from bottom to top.
+func kwinStacking(report *kwinWindows) []int64 {
+	stacking := make([]int64, len(report.Stacking))
+	for i, id := range report.Stacking {
+		stacking[i] = hash(id)
+	}
+	return stacking
+}
+
+// kwinSnapshot converts the report sent by kwinScript into a
+// Snapshot.
+func kwinSnapshot(report *kwinWindows) *Snapshot {
+	var snap Snapshot
+	for _, d := range report.Desktops {
+		snap.Desktops = append(snap.Desktops, &Desktop{ID: d.ID, Name: d.Name})
+	}
+	snap.CurrentDesktop = &report.CurrentDesktop
+	for _, kw := range report.Windows {
+		// KWin identifies windows by UUID, so derive a numerical
+		// ID from it.
+		w := Window{
+			ID:         hash(kw.ID),
+			Desktop:    kw.Desktop,
+			Name:       kw.Caption,
+			Class:      kw.ResourceClass,
+			Instance:   kw.ResourceName,
+			Role:       kw.Role,
+			Monitor:    kw.Output,
+			Geometry:   kw.Rect,
+			Fullscreen: kw.Fullscreen,
+			Minimized:  kw.Minimized,
+		}
+		if kw.PID > 0 {
+			w.PID = kw.PID
+			w.Exe = processExe(kw.PID)
+		}
+		if w.IsSystem() {
+			continue
+		}
+		snap.Windows = append(snap.Windows, &w)
+		if kw.Active {
+			snap.Active = w.ID
+		}
+		if !kw.Minimized && w.IsOnDesktop(report.CurrentDesktop) {
+			snap.Visible = append(snap.Visible, w.ID)
+		}
+	}
+	return &snap
+}
@@ -0,0 +1,202 @@
+package thyme
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// fakeKWin stands in for KWin's scripting D-Bus API. Running a loaded
+// script sends report to the D-Bus name the script reports back to,
+// unless report is empty.
+type fakeKWin struct {
+	t    *testing.T
+	conn *dbus.Conn
+
+	// legacy exports loaded scripts at /N, like older versions of
+	// KWin do, rather than at /Scripting/ScriptN.
+	legacy bool
+	report string
+
+	// stale is sent with another script's token, before report is,
+	// as if an earlier script that timed out reported late.
+	stale string
+
+	mu       sync.Mutex
+	scripts  int32
+	loaded   map[string]bool
+	unloaded chan string
+}
+
+var kwinCallDBusRx = regexp.MustCompile(`callDBus\("([^"]+)", "[^"]+", "[^"]+", "Report",\s+"([^"]+)"`)
+
+func (k *fakeKWin) LoadScript(path, plugin string) (int32, *dbus.Error) {
+	script, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, dbus.NewError("org.kde.kwin.Scripting.Error", []interface{}{err.Error()})
+	}
+	m := kwinCallDBusRx.FindSubmatch(script)
+	if m == nil {
+		k.t.Errorf("script doesn't report back over D-Bus:\n%s", script)
+		return 0, dbus.NewError("org.kde.kwin.Scripting.Error", []interface{}{"bad script"})
+	}
+
+	k.mu.Lock()
+	k.scripts++
+	id := k.scripts
+	k.loaded[plugin] = true
+	k.mu.Unlock()
+
+	path = fmt.Sprintf("/Scripting/Script%d", id)
+	if k.legacy {
+		path = fmt.Sprintf("/%d", id)
+	}
+	run := &fakeKWinScript{conn: k.conn, dest: string(m[1]), token: string(m[2]), report: k.report, stale: k.stale}
+	if err := k.conn.ExportWithMap(run, map[string]string{"Run": "run"}, dbus.ObjectPath(path), "org.kde.kwin.Script"); err != nil {
+		k.t.Error(err)
+	}
+	return id, nil
+}
+
+func (k *fakeKWin) UnloadScript(plugin string) (bool, *dbus.Error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if !k.loaded[plugin] {
+		return false, nil
+	}
+	delete(k.loaded, plugin)
+	k.unloaded <- plugin
+	return true, nil
+}
+
+type fakeKWinScript struct {
+	conn          *dbus.Conn
+	dest, token   string
+	report, stale string
+}
+
+func (s *fakeKWinScript) Run() *dbus.Error {
+	receiver := s.conn.Object(s.dest, kwinReceiverPath)
+	delay := time.Duration(0)
+	if s.stale != "" {
+		receiver.Go(kwinReceiverIface+".Report", dbus.FlagNoReplyExpected, nil, "thyme-0-0", s.stale)
+		delay = 100 * time.Millisecond
+	}
+	if s.report != "" {
+		time.AfterFunc(delay, func() {
+			receiver.Go(kwinReceiverIface+".Report", dbus.FlagNoReplyExpected, nil, s.token, s.report)
+		})
+	}
+	return nil
+}
+
+// startFakeKWin exports a fakeKWin on the private session bus.
+func startFakeKWin(t *testing.T, legacy bool, report, stale string) *fakeKWin {
+	conn := sessionConn(t, "org.kde.KWin")
+	k := &fakeKWin{t: t, conn: conn, legacy: legacy, report: report, stale: stale, loaded: make(map[string]bool), unloaded: make(chan string, 1)}
+	if err := conn.ExportWithMap(k, map[string]string{"LoadScript": "loadScript", "UnloadScript": "unloadScript"}, "/Scripting", "org.kde.kwin.Scripting"); err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// waitUnloaded waits for the tracker to unload the script it loaded.
+func (k *fakeKWin) waitUnloaded() {
+	select {
+	case <-k.unloaded:
+	case <-time.After(5 * time.Second):
+		k.t.Error("script wasn't unloaded")
+	}
+}
+
+func TestKWinTracker(t *testing.T) {
+	report, err := ioutil.ReadFile(filepath.Join("testdata", "kwin", "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		legacy bool
+		stale  string
+	}{
+		{name: "plasma"},
+		{name: "legacy script path", legacy: true},
+		{name: "stale report", stale: `{"windows":[],"desktops":[],"current_desktop":0}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kwin := startFakeKWin(t, test.legacy, string(report), test.stale)
+			snap, err := NewKWinTracker().Snap(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			kwin.waitUnloaded()
+
+			dolphin := hash("{0e6d3c8a-3f55-4b7e-9a51-5f1f4c0f2a11}")
+			kate := hash("{6a1b9e4f-2c7d-4d0a-8f3e-1b2c3d4e5f60}")
+			konsole := hash("{9c8b7a6d-5e4f-4a3b-9c2d-1e0f9a8b7c6d}")
+			elisa := hash("{f1e2d3c4-b5a6-4978-8695-a4b3c2d1e0f9}")
+			want := []*Window{
+				{ID: dolphin, Desktop: 1, Name: "Dolphin", Class: "org.kde.dolphin", Instance: "dolphin", Role: "Dolphin#1", PID: 4101, Monitor: "eDP-1", Geometry: &Rect{0, 0, 1920, 1036}},
+				{ID: kate, Desktop: 0, Name: "main.go — thyme — Kate", Class: "org.kde.kate", Instance: "kate", Role: "MainWindow#1", PID: 4202, Monitor: "eDP-1", Geometry: &Rect{0, 0, 1280, 1036}},
+				{ID: konsole, Desktop: 0, Name: "~ : bash — Konsole", Class: "org.kde.konsole", Instance: "konsole", Role: "MainWindow#1", PID: 4303, Monitor: "eDP-1", Geometry: &Rect{640, 518, 1280, 518}},
+				{ID: elisa, Desktop: -1, Name: "Elisa", Class: "org.kde.elisa", Instance: "elisa", PID: 4404, Monitor: "eDP-1", Geometry: &Rect{0, 0, 1920, 1036}, Minimized: true},
+			}
+			if !reflect.DeepEqual(withoutExe(snap.Windows), want) {
+				t.Errorf("got windows\n%s\nwant\n%s", windowsString(snap.Windows), windowsString(want))
+			}
+			if snap.Active != konsole {
+				t.Errorf("got active window %d, want %d", snap.Active, konsole)
+			}
+			if want := []int64{kate, konsole}; !reflect.DeepEqual(snap.Visible, want) {
+				t.Errorf("got visible windows %v, want %v", snap.Visible, want)
+			}
+			if snap.CurrentDesktop == nil || *snap.CurrentDesktop != 0 {
+				t.Errorf("got current desktop %v, want 0", snap.CurrentDesktop)
+			}
+			if want := []*Desktop{{ID: 0, Name: "Code"}, {ID: 1, Name: "Files"}}; !reflect.DeepEqual(snap.Desktops, want) {
+				t.Errorf("got desktops %+v, want %+v", snap.Desktops, want)
+			}
+			// Konsole covers the bottom right quarter of Kate.
+			if got, want := snap.VisibleFraction[kate], 1-float64(640*518)/(1280*1036); got != want {
+				t.Errorf("got visible fraction %v for kate, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestKWinTrackerTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { kwinTimeout = timeout }(kwinTimeout)
+	kwinTimeout = 100 * time.Millisecond
+
+	// The script runs, but never reports back.
+	kwin := startFakeKWin(t, false, "", "")
+	if _, err := NewKWinTracker().Snap(context.Background()); err == nil {
+		t.Error("got no error when the script didn't report back")
+	}
+	kwin.waitUnloaded()
+}
+
+func TestKWinTrackerProbe(t *testing.T) {
+	t.Setenv("XDG_CURRENT_DESKTOP", "GNOME")
+	if err := NewKWinTracker().(Prober).Probe(); err == nil {
+		t.Error("got no error outside of KDE")
+	}
+	t.Setenv("XDG_CURRENT_DESKTOP", "KDE")
+	startSessionBus(t)
+	if err := NewKWinTracker().(Prober).Probe(); err == nil {
+		t.Error("got no error while KWin isn't running")
+	}
+	startFakeKWin(t, false, "", "")
+	if err := NewKWinTracker().(Prober).Probe(); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,11 +1,14 @@
 package thyme
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,13 +16,76 @@ func init() {
 	RegisterTracker("linux", NewLinuxTracker)
 }
 
+// CommandRunner runs external programs on behalf of a Tracker that
+// gathers its data from command-line utilities. Substituting a
+// CommandRunner that replays recorded output makes it possible to
+// exercise such a Tracker without a live windowing system.
+// Implementations must be safe to call from multiple goroutines at
+// once.
+type CommandRunner interface {
+	// Output runs the named program with the given arguments and
+	// returns its standard output. The program is killed if ctx is
+	// done before it exits.
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+
+	// LookPath returns the path of the named program, like
+	// exec.LookPath does.
+	LookPath(name string) (string, error)
+
+	// ProcessExe returns the path of the executable of the process
+	// with the specified PID, or "" if it can't be determined.
+	ProcessExe(pid int64) string
+}
+
+// execRunner is the CommandRunner that actually executes programs.
+type execRunner struct{}
+
+func (execRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil && ctx.Err() != nil {
+		// Report why the program was killed rather than how.
+		return nil, ctx.Err()
+	}
+	return out, err
+}
+
+func (execRunner) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+func (execRunner) ProcessExe(pid int64) string {
+	return processExe(pid)
+}
+
+// isNotFound returns true if err indicates that a program could not
+// be run because it isn't installed.
+func isNotFound(err error) bool {
+	execErr, ok := err.(*exec.Error)
+	return ok && execErr.Err == exec.ErrNotFound
+}
+
 // LinuxTracker tracks application usage on Linux via a few standard command-line utilities.
-type LinuxTracker struct{}
+type LinuxTracker struct {
+	run CommandRunner
+}
 
 var _ Tracker = (*LinuxTracker)(nil)
 
 func NewLinuxTracker() Tracker {
-	return &LinuxTracker{}
+	return NewLinuxTrackerWithRunner(execRunner{})
+}
+
+// NewLinuxTrackerWithRunner returns a LinuxTracker that runs the
+// command-line utilities it depends on through run.
+func NewLinuxTrackerWithRunner(run CommandRunner) Tracker {
+	return &LinuxTracker{run: run}
+}
+
+// Capabilities reports idle support only if xprintidle, which is
+// optional, is installed.
+func (t *LinuxTracker) Capabilities() Capabilities {
+	_, err := t.run.LookPath("xprintidle")
+	return Capabilities{Visibility: true, Idle: err == nil}
 }
 
 func (t *LinuxTracker) Deps() string {
@@ -29,150 +95,544 @@ Install the following command-line utilities via your package manager of choice:
 * xwininfo
 * xdotool
 * wmctrl
+* xprintidle (optional, for idle detection)
+* xprop (optional, for window roles, window states, and telling how much of each window is covered by others)
+* xrandr (optional, for telling which windows are visible on multi-monitor setups)
 
 For example:
-* Debian: apt-get install x11-utils xdotool wmctrl
+* Debian: apt-get install x11-utils xdotool wmctrl xprintidle
 
-Note: this command prints out this message regardless of whether the dependencies are already installed.
+Note: this command prints out this message regardless of whether the dependencies are already installed. Run
+"thyme dep --check" to check which ones are.
 `
 }
 
-func (t *LinuxTracker) Snap() (*Snapshot, error) {
-	var viewWidth, viewHeight int
+func (t *LinuxTracker) CheckDeps() []*Dependency {
+	return []*Dependency{
+		checkProbe("X11 session", requireX11, nil),
+		checkProgram(t.run.LookPath, "xdpyinfo", false, map[string]string{
+			"debian": "apt-get install x11-utils",
+			"fedora": "dnf install xdpyinfo",
+			"arch":   "pacman -S xorg-xdpyinfo",
+		}),
+		checkProgram(t.run.LookPath, "xwininfo", false, map[string]string{
+			"debian": "apt-get install x11-utils",
+			"fedora": "dnf install xwininfo",
+			"arch":   "pacman -S xorg-xwininfo",
+		}),
+		checkProgram(t.run.LookPath, "xdotool", false, map[string]string{
+			"debian": "apt-get install xdotool",
+			"fedora": "dnf install xdotool",
+			"arch":   "pacman -S xdotool",
+		}),
+		checkProgram(t.run.LookPath, "wmctrl", false, map[string]string{
+			"debian": "apt-get install wmctrl",
+			"fedora": "dnf install wmctrl",
+			"arch":   "pacman -S wmctrl",
+		}),
+		checkProgram(t.run.LookPath, "xprintidle", true, map[string]string{
+			"debian": "apt-get install xprintidle",
+			"fedora": "dnf install xprintidle",
+			"arch":   "install xprintidle from the AUR",
+		}),
+		checkProgram(t.run.LookPath, "xprop", true, map[string]string{
+			"debian": "apt-get install x11-utils",
+			"fedora": "dnf install xprop",
+			"arch":   "pacman -S xorg-xprop",
+		}),
+		checkProgram(t.run.LookPath, "xrandr", true, map[string]string{
+			"debian": "apt-get install x11-xserver-utils",
+			"fedora": "dnf install xrandr",
+			"arch":   "pacman -S xorg-xrandr",
+		}),
+	}
+}
+
+func (t *LinuxTracker) Probe() error {
+	if err := requireX11(); err != nil {
+		return err
+	}
+	return requirePrograms(t.run.LookPath, "xdpyinfo", "xwininfo", "xdotool", "wmctrl")
+}
+
+func (t *LinuxTracker) Snap(ctx context.Context) (*Snapshot, error) {
+	monitors, err := t.monitors(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var windows []*Window
 	{
-		out, err := exec.Command("bash", "-c", "xdpyinfo | grep dimensions").Output()
+		out, err := t.run.Output(ctx, "wmctrl", "-l", "-p", "-x")
 		if err != nil {
-			return nil, fmt.Errorf("xdpyinfo failed with error: %s. Try running `xdpyinfo | grep dimensions` to diagnose.", err)
+			return nil, fmt.Errorf("wmctrl failed with error: %s. Try running `wmctrl -lpx` to diagnose.", err)
 		}
-		matches := dimRx.FindStringSubmatch(string(out))
-		if len(matches) != 3 {
-			return nil, fmt.Errorf("could not parse viewport dimensions from output line %q", string(out))
-		}
-		w, err := strconv.Atoi(matches[1])
+		windows, err = parseWmctrlList(string(out))
 		if err != nil {
 			return nil, err
 		}
-		h, err := strconv.Atoi(matches[2])
+	}
+
+	var currentDesktop int64
+	var desktops []*Desktop
+	{
+		out, err := t.run.Output(ctx, "wmctrl", "-d")
+		if err != nil {
+			return nil, fmt.Errorf("wmctrl failed with error: %s. Try running `wmctrl -d` to diagnose.", err)
+		}
+		currentDesktop, desktops, err = parseWmctrlDesktops(string(out))
 		if err != nil {
 			return nil, err
 		}
-		viewWidth, viewHeight = w, h
 	}
 
-	var windows []*Window
+	// Windows can close between `wmctrl -l` and the calls to
+	// `xwininfo` below, so a window whose details can't be read is
+	// left out of the snapshot with a warning instead of failing the
+	// whole snapshot.
+	var warnings []string
 	{
-		out, err := exec.Command("wmctrl", "-l").Output()
-		if err != nil {
-			return nil, fmt.Errorf("wmctrl failed with error: %s. Try running `wmctrl -l` to diagnose.", err)
+		errs := t.windowDetails(ctx, windows)
+		if ctx.Err() != nil {
+			// The windows aren't to blame, so give up on the
+			// snapshot.
+			return nil, ctx.Err()
 		}
-		lines := strings.Split(string(out), "\n")
-		for _, line := range lines {
-			fields := strings.Fields(line)
-			if len(fields) < 4 {
+		present := windows[:0]
+		for i, window := range windows {
+			if errs[i] != nil {
+				warnings = append(warnings, fmt.Sprintf("left out window %d (%q): %s", window.ID, window.Name, errs[i]))
 				continue
 			}
-			id_, desktop_, name := fields[0], fields[1], strings.Join(fields[3:], " ")
-			id, err := strconv.ParseInt(id_, 0, 64)
-			if err != nil {
-				return nil, err
-			}
-			desktop, err := strconv.ParseInt(desktop_, 0, 64)
-			if err != nil {
-				return nil, err
-			}
-			w := Window{ID: id, Desktop: desktop, Name: name}
-			if !w.IsSystem() {
-				windows = append(windows, &w)
-			}
+			present = append(present, window)
 		}
+		windows = present
 	}
 
-	var currentDesktop int64
+	var active int64
 	{
-		out, err := exec.Command("wmctrl", "-d").Output()
+		out, err := t.run.Output(ctx, "xdotool", "getactivewindow")
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("xdotool failed with error: %s. Try running `xdotool getactivewindow` to diagnose.", err)
 		}
-		lines := strings.Split(string(out), "\n")
-		for _, line := range lines {
-			fields := strings.Fields(line)
-			if len(fields) < 2 {
-				continue
-			}
-			id_, mode := fields[0], fields[1]
-			id, err := strconv.ParseInt(id_, 0, 64)
-			if err != nil {
-				return nil, err
-			}
-			if "*" == mode {
-				currentDesktop = id
-			}
+		id, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+		if err != nil {
+			return nil, err
 		}
+		active = id
+	}
+
+	idle, err := t.idle(ctx)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		warnings = append(warnings, err.Error())
 	}
 
-	var visible []int64
+	snap := &Snapshot{
+		Windows:        windows,
+		Active:         active,
+		Idle:           idle,
+		Desktops:       desktops,
+		CurrentDesktop: &currentDesktop,
+		Warnings:       warnings,
+		Time:           time.Now(),
+	}
+	placeWindows(snap, monitors, currentDesktop)
+
+	// The stacking order comes from xprop, which is optional; if it
+	// isn't installed, VisibleFraction isn't recorded.
 	{
-		for _, window := range windows {
-			out_, err := exec.Command("xwininfo", "-id", fmt.Sprintf("%d", window.ID), "-stats").Output()
-			if err != nil {
-				return nil, fmt.Errorf("xwininfo failed with error: %s", err)
-			}
-			out := string(out_)
-			x, err := parseWinDim(xRx, out, "X")
-			if err != nil {
-				return nil, err
-			}
-			y, err := parseWinDim(yRx, out, "Y")
+		out, err := t.run.Output(ctx, "xprop", "-root", "_NET_CLIENT_LIST_STACKING")
+		if err == nil {
+			stacking, err := parseXpropWindows(string(out))
 			if err != nil {
 				return nil, err
 			}
-			w, err := parseWinDim(wRx, out, "W")
-			if err != nil {
-				return nil, err
-			}
-			h, err := parseWinDim(hRx, out, "H")
-			if err != nil {
-				return nil, err
-			}
-			if window.IsOnDesktop(currentDesktop) && isVisible(x, y, w, h, viewHeight, viewWidth) {
-				visible = append(visible, window.ID)
+			setVisibleFractions(snap, stacking)
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return snap, nil
+}
+
+// monitors returns the active monitors, as reported by `xrandr`.
+// xrandr is optional (and not every X server supports RandR), so if
+// it isn't available, the whole screen, as reported by `xdpyinfo`, is
+// treated as a single monitor.
+func (t *LinuxTracker) monitors(ctx context.Context) ([]*Monitor, error) {
+	out, err := t.run.Output(ctx, "xrandr", "--listactivemonitors")
+	if err == nil {
+		monitors, err := parseXrandrMonitors(string(out))
+		if err != nil {
+			return nil, err
+		}
+		if len(monitors) > 0 {
+			return monitors, nil
+		}
+	} else if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	out, err = t.run.Output(ctx, "xdpyinfo")
+	if err != nil {
+		return nil, fmt.Errorf("xdpyinfo failed with error: %s. Try running `xdpyinfo | grep dimensions` to diagnose.", err)
+	}
+	w, h, err := parseDimensions(string(out))
+	if err != nil {
+		return nil, err
+	}
+	return []*Monitor{{Geometry: Rect{Width: w, Height: h}}}, nil
+}
+
+// xwininfoWorkers is the maximum number of `xwininfo` processes
+// LinuxTracker runs at once.
+var xwininfoWorkers = 8
+
+// windowDetails fills in the Geometry, Role, Exe, and state of each
+// of windows. It returns the error that prevented reading the
+// geometry of each window, in the same order. Since every window
+// takes separate `xwininfo` and `xprop` calls, up to xwininfoWorkers
+// windows are queried concurrently.
+func (t *LinuxTracker) windowDetails(ctx context.Context, windows []*Window) []error {
+	errs := make([]error, len(windows))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < xwininfoWorkers && n < len(windows); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				w := windows[i]
+				w.Geometry, errs[i] = t.windowGeometry(ctx, w.ID)
+				if errs[i] == nil {
+					t.windowProps(ctx, w)
+					w.Exe = t.run.ProcessExe(w.PID)
+				}
 			}
+		}()
+	}
+	for i := range windows {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return errs
+}
+
+// windowGeometry returns the position and size of the window with the
+// specified ID, as reported by `xwininfo`.
+func (t *LinuxTracker) windowGeometry(ctx context.Context, id int64) (*Rect, error) {
+	out_, err := t.run.Output(ctx, "xwininfo", "-id", fmt.Sprintf("%d", id), "-stats")
+	if err != nil {
+		return nil, fmt.Errorf("xwininfo failed with error: %s", err)
+	}
+	out := string(out_)
+	var r Rect
+	if r.X, err = parseWinDim(xRx, out, "X"); err != nil {
+		return nil, err
+	}
+	if r.Y, err = parseWinDim(yRx, out, "Y"); err != nil {
+		return nil, err
+	}
+	if r.Width, err = parseWinDim(wRx, out, "W"); err != nil {
+		return nil, err
+	}
+	if r.Height, err = parseWinDim(hRx, out, "H"); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// idle returns how long the user has been idle according to
+// xprintidle. xprintidle is optional; if it isn't installed, idle
+// returns zero, so that idle time isn't recorded but the rest of the
+// snapshot is. If it fails (e.g., because the X server lacks the
+// MIT-SCREEN-SAVER extension), idle also returns an error, which Snap
+// records as a warning.
+func (t *LinuxTracker) idle(ctx context.Context) (time.Duration, error) {
+	out, err := t.run.Output(ctx, "xprintidle")
+	if err != nil {
+		if isNotFound(err) {
+			return 0, nil
 		}
+		return 0, fmt.Errorf("xprintidle failed with error: %s. Try running `xprintidle` to diagnose.", err)
+	}
+	ms, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse idle time from xprintidle output %q", string(out))
 	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
 
-	var active int64
-	{
-		out, err := exec.Command("xdotool", "getactivewindow").Output()
+// windowProps fills in the Role and state (fullscreen, maximized, or
+// minimized) of w from its properties, as reported by `xprop`. xprop
+// is optional, so they are left unset if it isn't installed or fails.
+func (t *LinuxTracker) windowProps(ctx context.Context, w *Window) {
+	out, err := t.run.Output(ctx, "xprop", "-id", fmt.Sprintf("%d", w.ID), "WM_WINDOW_ROLE", "_NET_WM_STATE")
+	if err != nil {
+		return
+	}
+	props := parseXprop(string(out))
+	if role, err := strconv.Unquote(props["WM_WINDOW_ROLE"]); err == nil {
+		w.Role = role
+	}
+	w.Fullscreen, w.Maximized, w.Minimized = netWMState(strings.Split(props["_NET_WM_STATE"], ", "))
+}
+
+// parseXprop parses the output of `xprop -id <id> <property>...` into
+// a map from property name to value (e.g., `WM_WINDOW_ROLE(STRING) =
+// "browser"` becomes "WM_WINDOW_ROLE": `"browser"`). Properties that
+// aren't set are left out.
+func parseXprop(out string) map[string]string {
+	props := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		i := strings.Index(line, " = ")
+		j := strings.Index(line, "(")
+		if i < 0 || j < 0 || j > i {
+			continue
+		}
+		props[line[:j]] = strings.TrimSpace(line[i+len(" = "):])
+	}
+	return props
+}
+
+// parseXpropWindows parses the window IDs from the output of `xprop
+// -root <property>` for a property that holds a list of windows, e.g.:
+//
+//	_NET_CLIENT_LIST_STACKING(WINDOW): window id # 0x1e00003, 0x2200003
+func parseXpropWindows(out string) ([]int64, error) {
+	i := strings.Index(out, "#")
+	if i < 0 {
+		// The property isn't set.
+		return nil, nil
+	}
+	var ids []int64
+	for _, field := range strings.Split(out[i+1:], ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(field), 0, 64)
 		if err != nil {
-			return nil, fmt.Errorf("xdotool failed with error: %s. Try running `xdotool getactivewindow` to diagnose.", err)
+			return nil, fmt.Errorf("could not parse window list from xprop output %q", out)
 		}
-		id, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// netWMState returns whether the _NET_WM_STATE atoms in states mark a
+// window as fullscreen, as maximized in both directions, or as hidden
+// (i.e., minimized).
+func netWMState(states []string) (fullscreen, maximized, hidden bool) {
+	var vert, horz bool
+	for _, state := range states {
+		switch state {
+		case "_NET_WM_STATE_FULLSCREEN":
+			fullscreen = true
+		case "_NET_WM_STATE_MAXIMIZED_VERT":
+			vert = true
+		case "_NET_WM_STATE_MAXIMIZED_HORZ":
+			horz = true
+		case "_NET_WM_STATE_HIDDEN":
+			hidden = true
+		}
+	}
+	return fullscreen, vert && horz, hidden
+}
+
+// processExe returns the path of the executable of the process with
+// the specified PID, read from /proc. It returns "" if it can't be
+// determined (e.g., because the process has exited, belongs to
+// another user, or runs on another machine).
+func processExe(pid int64) string {
+	if pid <= 0 {
+		return ""
+	}
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return ""
+	}
+	return exe
+}
+
+// parseDimensions parses the viewport width and height from the
+// output of `xdpyinfo`.
+func parseDimensions(out string) (int, int, error) {
+	matches := dimRx.FindStringSubmatch(out)
+	if len(matches) != 3 {
+		return 0, 0, fmt.Errorf("could not parse viewport dimensions from output %q", out)
+	}
+	w, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	h, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return 0, 0, err
+	}
+	return w, h, nil
+}
+
+// parseWmctrlList parses the non-system windows from the output of
+// `wmctrl -l -p -x`. wmctrl pads every column but the last (the
+// title) to the same width on every line, so the titles all start in
+// the same column, and are taken from there verbatim (runs of spaces
+// included).
+func parseWmctrlList(out string) ([]*Window, error) {
+	type wmctrlLine struct {
+		fields []string
+		line   string
+		end    int
+	}
+	var lines []wmctrlLine
+	var titleCol int
+	for _, line := range strings.Split(out, "\n") {
+		fields, end := splitFields(line, 5)
+		if len(fields) < 5 {
+			continue
+		}
+		lines = append(lines, wmctrlLine{fields, line, end})
+		if end+1 > titleCol {
+			titleCol = end + 1
+		}
+	}
+
+	var windows []*Window
+	for _, l := range lines {
+		// Fall back to the single space after the last field if the
+		// columns aren't aligned after all.
+		start := l.end + 1
+		if titleCol <= len(l.line) && strings.TrimSpace(l.line[l.end:titleCol]) == "" {
+			start = titleCol
+		}
+		if start >= len(l.line) {
+			continue
+		}
+		id_, desktop_, pid_, class_, name := l.fields[0], l.fields[1], l.fields[2], l.fields[3], l.line[start:]
+		id, err := strconv.ParseInt(id_, 0, 64)
 		if err != nil {
 			return nil, err
 		}
-		active = id
+		desktop, err := strconv.ParseInt(desktop_, 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		pid, err := strconv.ParseInt(pid_, 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		w := Window{ID: id, Desktop: desktop, Name: name, PID: pid}
+		w.Instance, w.Class = parseWmctrlClass(class_)
+		if !w.IsSystem() {
+			windows = append(windows, &w)
+		}
+	}
+	return windows, nil
+}
+
+// splitFields splits the first n whitespace-separated fields off of
+// line. It also returns the offset in line just past the last of
+// them.
+func splitFields(line string, n int) ([]string, int) {
+	var fields []string
+	var end int
+	for len(fields) < n {
+		start := end + len(line[end:]) - len(strings.TrimLeft(line[end:], " \t"))
+		if start == len(line) {
+			break
+		}
+		end = start + strings.IndexAny(line[start:]+" ", " \t")
+		fields = append(fields, line[start:end])
 	}
+	return fields, end
+}
 
-	return &Snapshot{Windows: windows, Active: active, Visible: visible, Time: time.Now()}, nil
+// parseWmctrlClass splits a WM_CLASS as printed by `wmctrl -x`, which
+// joins the instance and class with a dot (e.g., "Navigator.firefox").
+func parseWmctrlClass(s string) (instance, class string) {
+	if s == "N/A" {
+		return "", ""
+	}
+	// Both parts may contain dots themselves (e.g.,
+	// "org.gnome.Nautilus.Org.gnome.Nautilus"). They usually only
+	// differ in case, so split in the middle if that's the case.
+	if n := len(s); n%2 == 1 && s[n/2] == '.' && strings.EqualFold(s[:n/2], s[n/2+1:]) {
+		return s[:n/2], s[n/2+1:]
+	}
+	if i := strings.Index(s, "."); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
 }
 
-// isVisible checks if the window is visible in the current viewport.
-// x and y are assumed to be relative to the current viewport (i.e.,
-// (0, 0) is the coordinate of the top-left corner of the current
-// viewport.
-func isVisible(x, y, w, h, viewHeight, viewWidth int) bool {
-	return (0 <= x && x < viewWidth && 0 <= y && y < viewHeight) ||
-		(0 <= x+w && x+w < viewWidth && 0 <= y && y < viewHeight) ||
-		(0 <= x && x < viewWidth && 0 <= y+h && y+h < viewHeight) ||
-		(0 <= x+w && x+w < viewWidth && 0 <= y+h && y+h < viewHeight)
+// parseWmctrlDesktops parses the desktops and the ID of the current
+// desktop from the output of `wmctrl -d`, e.g.:
+//
+//	0  * DG: 1920x1080  VP: 0,0  WA: 0,25 1920x1055  review
+//	1  - DG: 1920x1080  VP: N/A  WA: 0,25 1920x1055  oncall
+func parseWmctrlDesktops(out string) (int64, []*Desktop, error) {
+	var currentDesktop int64
+	var desktops []*Desktop
+	lines := strings.Split(out, "\n")
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		id_, mode := fields[0], fields[1]
+		id, err := strconv.ParseInt(id_, 0, 64)
+		if err != nil {
+			return 0, nil, err
+		}
+		if "*" == mode {
+			currentDesktop = id
+		}
+		d := &Desktop{ID: id}
+		if matches := desktopNameRx.FindStringSubmatch(line); matches != nil {
+			d.Name = strings.TrimSpace(matches[1])
+		}
+		desktops = append(desktops, d)
+	}
+	return currentDesktop, desktops, nil
+}
+
+// parseXrandrMonitors parses the monitors from the output of `xrandr
+// --listactivemonitors`, e.g.:
+//
+//	Monitors: 2
+//	 0: +*eDP-1 1920/344x1080/193+0+0  eDP-1
+//	 1: +HDMI-1 2560/597x1440/336+1920+0  HDMI-1
+func parseXrandrMonitors(out string) ([]*Monitor, error) {
+	var monitors []*Monitor
+	for _, line := range strings.Split(out, "\n") {
+		matches := monitorRx.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		var dims [4]int
+		for i := range dims {
+			n, err := strconv.Atoi(matches[i+2])
+			if err != nil {
+				return nil, fmt.Errorf("could not parse monitor from xrandr output %q: %s", line, err)
+			}
+			dims[i] = n
+		}
+		monitors = append(monitors, &Monitor{
+			Name:     matches[1],
+			Geometry: Rect{X: dims[2], Y: dims[3], Width: dims[0], Height: dims[1]},
+		})
+	}
+	return monitors, nil
 }
 
 var (
-	dimRx = regexp.MustCompile(`dimensions:\s+([0-9]+)x([0-9]+)\s+pixels`)
-	xRx   = regexp.MustCompile(`Absolute upper\-left X:\s+(\-?[0-9]+)`)
-	yRx   = regexp.MustCompile(`Absolute upper\-left Y:\s+(\-?[0-9]+)`)
-	wRx   = regexp.MustCompile(`Width:\s+([0-9]+)`)
-	hRx   = regexp.MustCompile(`Height:\s+([0-9]+)`)
+	dimRx         = regexp.MustCompile(`dimensions:\s+([0-9]+)x([0-9]+)\s+pixels`)
+	desktopNameRx = regexp.MustCompile(`WA:\s+(?:N/A|\S+\s+\S+)\s+(.*)$`)
+	monitorRx     = regexp.MustCompile(`^\s*[0-9]+:\s+\+?\*?(\S+)\s+([0-9]+)/[0-9]+x([0-9]+)/[0-9]+\+(\-?[0-9]+)\+(\-?[0-9]+)`)
+	xRx           = regexp.MustCompile(`Absolute upper\-left X:\s+(\-?[0-9]+)`)
+	yRx           = regexp.MustCompile(`Absolute upper\-left Y:\s+(\-?[0-9]+)`)
+	wRx           = regexp.MustCompile(`Width:\s+([0-9]+)`)
+	hRx           = regexp.MustCompile(`Height:\s+([0-9]+)`)
 )
 
 // parseWinDim parses window dimension info from the output of `xwininfo`
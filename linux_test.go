@@ -0,0 +1,565 @@
+package thyme
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRunner is a CommandRunner that replays output recorded in a
+// script in testdata/linux. A script consists of commands, each on a
+// line starting with "$ ", followed by their output. A command whose
+// output is a single line starting with "! " fails with the rest of
+// that line as its error. Programs that don't appear in the script at
+// all aren't installed. ProcessExe reads the output of the command
+// "readlink /proc/<pid>/exe".
+type fakeRunner struct {
+	outputs  map[string]string
+	errors   map[string]string
+	programs map[string]bool
+}
+
+func loadFakeRunner(t testing.TB, name string) *fakeRunner {
+	f, err := os.Open(filepath.Join("testdata", "linux", name+".txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r := &fakeRunner{outputs: make(map[string]string), errors: make(map[string]string), programs: make(map[string]bool)}
+	var cmd string
+	var out []string
+	flush := func() {
+		if cmd == "" {
+			return
+		}
+		// Blank lines separate commands.
+		for len(out) > 0 && out[len(out)-1] == "" {
+			out = out[:len(out)-1]
+		}
+		if len(out) == 1 && strings.HasPrefix(out[0], "! ") {
+			r.errors[cmd] = strings.TrimPrefix(out[0], "! ")
+		} else {
+			r.outputs[cmd] = strings.Join(out, "\n") + "\n"
+		}
+		r.programs[strings.Fields(cmd)[0]] = true
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "$ "):
+			flush()
+			cmd, out = strings.TrimPrefix(line, "$ "), nil
+		case cmd == "" && (line == "" || strings.HasPrefix(line, "#")):
+		default:
+			out = append(out, line)
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func (r *fakeRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !r.programs[name] {
+		return nil, &exec.Error{Name: name, Err: exec.ErrNotFound}
+	}
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	if msg, ok := r.errors[cmd]; ok {
+		return nil, errors.New(msg)
+	}
+	out, ok := r.outputs[cmd]
+	if !ok {
+		return nil, fmt.Errorf("no recorded output for %q", cmd)
+	}
+	return []byte(out), nil
+}
+
+func (r *fakeRunner) LookPath(name string) (string, error) {
+	if !r.programs[name] {
+		return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+	}
+	return filepath.Join("/usr/bin", name), nil
+}
+
+func (r *fakeRunner) ProcessExe(pid int64) string {
+	return strings.TrimSpace(r.outputs[fmt.Sprintf("readlink /proc/%d/exe", pid)])
+}
+
+func TestLinuxTrackerMultiDesktop(t *testing.T) {
+	tracker := NewLinuxTrackerWithRunner(loadFakeRunner(t, "multidesktop"))
+	snap, err := tracker.Snap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Window{
+		{ID: 0x1e00003, Desktop: 0, Name: "Mozilla Firefox", Class: "firefox", Instance: "Navigator", Role: "browser", PID: 1234, Exe: "/usr/lib/firefox/firefox", Monitor: "eDP-1", Geometry: &Rect{0, 0, 1920, 1080}, Maximized: true},
+		{ID: 0x2200003, Desktop: 1, Name: "main.go - thyme - Visual Studio Code", Class: "Code", Instance: "code", PID: 2345, Monitor: "eDP-1", Geometry: &Rect{0, 0, 1920, 1080}, Minimized: true},
+		// xclock is only maximized vertically, and more of it is on
+		// eDP-1 than on HDMI-1.
+		{ID: 0x2400003, Desktop: -1, Name: "xclock", Class: "XClock", Instance: "xclock", PID: 3456, Monitor: "eDP-1", Geometry: &Rect{-200, 900, 400, 164}},
+		{ID: 0x2600003, Desktop: 0, Name: "vim   notes.txt", Class: "XTerm", Instance: "xterm", PID: 4567, Exe: "/usr/bin/xterm", Monitor: "HDMI-1", Geometry: &Rect{-1000, 100, 800, 600}, Fullscreen: true},
+	}
+	if !reflect.DeepEqual(snap.Windows, want) {
+		t.Errorf("got windows\n%s\nwant\n%s", windowsString(snap.Windows), windowsString(want))
+	}
+	if snap.Active != 0x2600003 {
+		t.Errorf("got active window %#x, want %#x", snap.Active, 0x2600003)
+	}
+	// Visual Studio Code is on the other desktop.
+	if want := []int64{0x1e00003, 0x2400003, 0x2600003}; !reflect.DeepEqual(snap.Visible, want) {
+		t.Errorf("got visible windows %#x, want %#x", snap.Visible, want)
+	}
+	wantMonitors := []*Monitor{
+		{Name: "eDP-1", Geometry: Rect{0, 0, 1920, 1080}, Visible: []int64{0x1e00003, 0x2400003}},
+		{Name: "HDMI-1", Geometry: Rect{-1280, 0, 1280, 1024}, Visible: []int64{0x2400003, 0x2600003}},
+	}
+	if !reflect.DeepEqual(snap.Monitors, wantMonitors) {
+		t.Errorf("got monitors %+v, want %+v", snap.Monitors, wantMonitors)
+	}
+
+	// Firefox is covered by the part of xclock that is on eDP-1, and
+	// xclock sticks out below HDMI-1.
+	if got, want := snap.VisibleFraction[0x1e00003], 1-float64(200*164)/(1920*1080); got != want {
+		t.Errorf("got visible fraction %v for firefox, want %v", got, want)
+	}
+	if got, want := snap.VisibleFraction[0x2400003], float64(200*124+200*164)/(400*164); got != want {
+		t.Errorf("got visible fraction %v for xclock, want %v", got, want)
+	}
+	if got := snap.VisibleFraction[0x2600003]; got != 1 {
+		t.Errorf("got visible fraction %v for xterm, want 1", got)
+	}
+	if snap.Idle != 4200*time.Millisecond {
+		t.Errorf("got idle time %s, want 4.2s", snap.Idle)
+	}
+	if snap.CurrentDesktop == nil || *snap.CurrentDesktop != 0 {
+		t.Errorf("got current desktop %v, want 0", snap.CurrentDesktop)
+	}
+	if want := []*Desktop{{ID: 0, Name: "review"}, {ID: 1, Name: "on call"}}; !reflect.DeepEqual(snap.Desktops, want) {
+		t.Errorf("got desktops %+v, want %+v", snap.Desktops, want)
+	}
+}
+
+func TestLinuxTrackerIdle(t *testing.T) {
+	tests := []struct {
+		script       string
+		want         time.Duration
+		wantWarnings int
+	}{
+		{"multidesktop", 4200 * time.Millisecond, 0},
+		// xprintidle isn't installed.
+		{"minimal", 0, 0},
+		// xprintidle is installed but fails, which shouldn't prevent
+		// the rest of the snapshot from being taken.
+		{"noscreensaver", 0, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.script, func(t *testing.T) {
+			snap, err := NewLinuxTrackerWithRunner(loadFakeRunner(t, test.script)).Snap(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if snap.Idle != test.want {
+				t.Errorf("got idle time %s, want %s", snap.Idle, test.want)
+			}
+			if len(snap.Windows) == 0 || snap.Active == 0 {
+				t.Errorf("got windows\n%s\nand active window %#x, want the rest of the snapshot", windowsString(snap.Windows), snap.Active)
+			}
+			if len(snap.Warnings) != test.wantWarnings {
+				t.Errorf("got warnings %q, want %d", snap.Warnings, test.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestLinuxTrackerClosedWindow(t *testing.T) {
+	snap, err := NewLinuxTrackerWithRunner(loadFakeRunner(t, "closedwindow")).Snap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The closed window is left out of the snapshot, with a warning.
+	if want := []*Window{{ID: 0x1e00003, Desktop: 0, Name: "Mozilla Firefox", Class: "firefox", Instance: "Navigator", PID: 1234, Geometry: &Rect{0, 0, 1920, 1080}}}; !reflect.DeepEqual(snap.Windows, want) {
+		t.Errorf("got windows\n%s\nwant\n%s", windowsString(snap.Windows), windowsString(want))
+	}
+	if want := []int64{0x1e00003}; !reflect.DeepEqual(snap.Visible, want) {
+		t.Errorf("got visible windows %#x, want %#x", snap.Visible, want)
+	}
+	// Without xrandr, the whole screen is a single monitor.
+	if want := []*Monitor{{Geometry: Rect{0, 0, 1920, 1080}, Visible: []int64{0x1e00003}}}; !reflect.DeepEqual(snap.Monitors, want) {
+		t.Errorf("got monitors %+v, want %+v", snap.Monitors, want)
+	}
+	// Without xprop, the stacking order is unknown.
+	if snap.VisibleFraction != nil {
+		t.Errorf("got visible fractions %v without xprop", snap.VisibleFraction)
+	}
+	if len(snap.Warnings) != 1 || !strings.Contains(snap.Warnings[0], "vim notes.txt") {
+		t.Errorf("got warnings %q, want one about the closed window", snap.Warnings)
+	}
+}
+
+// gridRunner returns a fakeRunner for a 1920x1080 screen with n
+// windows tiled in a grid, 8 to a row. Every seventh window closes
+// before it can be queried.
+func gridRunner(n int) (*fakeRunner, []int64) {
+	r := &fakeRunner{outputs: make(map[string]string), errors: make(map[string]string), programs: make(map[string]bool)}
+	for _, program := range []string{"xdpyinfo", "wmctrl", "xwininfo", "xprop", "xdotool"} {
+		r.programs[program] = true
+	}
+	r.outputs["xdpyinfo"] = "screen #0:\n  dimensions:    1920x1080 pixels (508x285 millimeters)\n"
+	r.outputs["wmctrl -d"] = "0  * DG: 1920x1080  VP: 0,0  WA: 0,0 1920x1080  grid\n"
+
+	var ids []int64
+	var list []string
+	for i := 0; i < n; i++ {
+		id := int64(0x2000003 + i<<20)
+		ids = append(ids, id)
+		list = append(list, fmt.Sprintf("0x%08x  0 %-6d %-20s host Window %d", id, 1000+i, fmt.Sprintf("app%d.App%d", i, i), i))
+		if i%7 == 6 {
+			r.errors[fmt.Sprintf("xwininfo -id %d -stats", id)] = "X Error: BadWindow (invalid Window parameter)"
+			continue
+		}
+		r.outputs[fmt.Sprintf("xwininfo -id %d -stats", id)] = fmt.Sprintf("  Absolute upper-left X:  %d\n  Absolute upper-left Y:  %d\n  Width: 240\n  Height: 135\n", i%8*240, i/8%8*135)
+		r.outputs[fmt.Sprintf("xprop -id %d WM_WINDOW_ROLE _NET_WM_STATE", id)] = "WM_WINDOW_ROLE:  not found.\n_NET_WM_STATE:  no such atom on any window.\n"
+	}
+	r.outputs["wmctrl -l -p -x"] = strings.Join(list, "\n") + "\n"
+	r.outputs["xdotool getactivewindow"] = fmt.Sprintf("%d\n", ids[0])
+	return r, ids
+}
+
+// slowRunner delays the commands of a fakeRunner, like a busy X
+// server would, and records the order in which they finish.
+type slowRunner struct {
+	*fakeRunner
+	delay func(cmd string) time.Duration
+
+	mu       sync.Mutex
+	finished []string
+}
+
+func (r *slowRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	select {
+	case <-time.After(r.delay(cmd)):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	r.mu.Lock()
+	r.finished = append(r.finished, cmd)
+	r.mu.Unlock()
+	return r.fakeRunner.Output(ctx, name, args...)
+}
+
+func TestLinuxTrackerOrder(t *testing.T) {
+	const n = 32
+	fake, ids := gridRunner(n)
+	// Windows listed earlier take longer to query, so the workers
+	// finish them out of order.
+	delays := make(map[string]time.Duration)
+	for i, id := range ids {
+		delays[fmt.Sprintf("xwininfo -id %d -stats", id)] = time.Duration(n-i) * time.Millisecond
+	}
+	runner := &slowRunner{fakeRunner: fake, delay: func(cmd string) time.Duration { return delays[cmd] }}
+	snap, err := NewLinuxTrackerWithRunner(runner).Snap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var queried []string
+	for _, cmd := range runner.finished {
+		if strings.HasPrefix(cmd, "xwininfo ") {
+			queried = append(queried, cmd)
+		}
+	}
+	if len(queried) != n || queried[0] == fmt.Sprintf("xwininfo -id %d -stats", ids[0]) {
+		t.Fatalf("windows weren't queried concurrently: %q", queried)
+	}
+
+	// The results still line up with the windows they belong to.
+	var want, got []int64
+	var wantWarnings []string
+	for i, id := range ids {
+		if i%7 == 6 {
+			wantWarnings = append(wantWarnings, fmt.Sprintf("left out window %d (%q): xwininfo failed with error: X Error: BadWindow (invalid Window parameter)", id, fmt.Sprintf("Window %d", i)))
+			continue
+		}
+		want = append(want, id)
+	}
+	for _, w := range snap.Windows {
+		got = append(got, w.ID)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got windows %#x, want %#x", got, want)
+	}
+	if !reflect.DeepEqual(snap.Visible, want) {
+		t.Errorf("got visible windows %#x, want %#x", snap.Visible, want)
+	}
+	if !reflect.DeepEqual(snap.Warnings, wantWarnings) {
+		t.Errorf("got warnings\n%s\nwant\n%s", strings.Join(snap.Warnings, "\n"), strings.Join(wantWarnings, "\n"))
+	}
+}
+
+func BenchmarkLinuxTrackerSnap(b *testing.B) {
+	fake, _ := gridRunner(64)
+	// Each command takes about as long as starting a process does.
+	runner := &slowRunner{fakeRunner: fake, delay: func(string) time.Duration { return 2 * time.Millisecond }}
+	defer func(workers int) { xwininfoWorkers = workers }(xwininfoWorkers)
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			xwininfoWorkers = workers
+			tracker := NewLinuxTrackerWithRunner(runner)
+			for i := 0; i < b.N; i++ {
+				if _, err := tracker.Snap(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestLinuxTrackerCapabilities(t *testing.T) {
+	if caps := NewLinuxTrackerWithRunner(loadFakeRunner(t, "multidesktop")).Capabilities(); !caps.Idle {
+		t.Errorf("got capabilities %+v, want idle support with xprintidle installed", caps)
+	}
+	if caps := NewLinuxTrackerWithRunner(loadFakeRunner(t, "minimal")).Capabilities(); caps.Idle {
+		t.Errorf("got capabilities %+v, want no idle support without xprintidle", caps)
+	}
+}
+
+func TestLinuxTrackerMissingProgram(t *testing.T) {
+	r := loadFakeRunner(t, "minimal")
+	delete(r.programs, "wmctrl")
+	if _, err := NewLinuxTrackerWithRunner(r).Snap(context.Background()); err == nil || !strings.Contains(err.Error(), "wmctrl") {
+		t.Errorf("got error %v, want one about wmctrl", err)
+	}
+}
+
+// cancelingRunner is a fakeRunner that calls cancel when the program
+// named at is run.
+type cancelingRunner struct {
+	*fakeRunner
+	at     string
+	cancel context.CancelFunc
+}
+
+func (r *cancelingRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if name == r.at {
+		r.cancel()
+	}
+	return r.fakeRunner.Output(ctx, name, args...)
+}
+
+func TestLinuxTrackerCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &cancelingRunner{fakeRunner: loadFakeRunner(t, "multidesktop"), at: "xwininfo", cancel: cancel}
+	// A window whose details couldn't be read because the snapshot
+	// was canceled isn't left out with a warning; the whole snapshot
+	// fails.
+	if _, err := NewLinuxTrackerWithRunner(r).Snap(ctx); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestLinuxTrackerProbe(t *testing.T) {
+	setDetectEnv(t, map[string]string{"DISPLAY": ":0"}, "")
+	r := loadFakeRunner(t, "minimal")
+	if err := NewLinuxTrackerWithRunner(r).(Prober).Probe(); err != nil {
+		t.Fatal(err)
+	}
+	delete(r.programs, "wmctrl")
+	if err := NewLinuxTrackerWithRunner(r).(Prober).Probe(); err == nil || !strings.Contains(err.Error(), "missing wmctrl") {
+		t.Errorf("got error %v, want one saying wmctrl is missing", err)
+	}
+}
+
+func TestLinuxTrackerCheckDeps(t *testing.T) {
+	setDetectEnv(t, map[string]string{"DISPLAY": ":0"}, "")
+	r := loadFakeRunner(t, "minimal")
+	delete(r.programs, "wmctrl")
+	found := make(map[string]bool)
+	for _, dep := range NewLinuxTrackerWithRunner(r).(DepChecker).CheckDeps() {
+		found[dep.Name] = dep.Found
+		if dep.Name == "wmctrl" && dep.Install["debian"] == "" {
+			t.Error("got no Debian install instructions for wmctrl")
+		}
+	}
+	want := map[string]bool{
+		"X11 session": true,
+		"xdpyinfo":    true,
+		"xwininfo":    true,
+		"xdotool":     true,
+		"wmctrl":      false,
+		// The minimal script doesn't run xprop, xprintidle, or
+		// xrandr.
+		"xprop":      false,
+		"xprintidle": false,
+		"xrandr":     false,
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("got dependencies found %v, want %v", found, want)
+	}
+}
+
+func TestNetWMState(t *testing.T) {
+	tests := []struct {
+		states                        []string
+		fullscreen, maximized, hidden bool
+	}{
+		{nil, false, false, false},
+		{[]string{"_NET_WM_STATE_FULLSCREEN"}, true, false, false},
+		{[]string{"_NET_WM_STATE_MAXIMIZED_VERT", "_NET_WM_STATE_MAXIMIZED_HORZ"}, false, true, false},
+		// Maximized in one direction only.
+		{[]string{"_NET_WM_STATE_STICKY", "_NET_WM_STATE_MAXIMIZED_VERT"}, false, false, false},
+		{[]string{"_NET_WM_STATE_MAXIMIZED_VERT", "_NET_WM_STATE_MAXIMIZED_HORZ", "_NET_WM_STATE_HIDDEN"}, false, true, true},
+	}
+	for _, test := range tests {
+		fullscreen, maximized, hidden := netWMState(test.states)
+		if fullscreen != test.fullscreen || maximized != test.maximized || hidden != test.hidden {
+			t.Errorf("%q: got fullscreen %v, maximized %v, hidden %v, want %v, %v, %v", test.states, fullscreen, maximized, hidden, test.fullscreen, test.maximized, test.hidden)
+		}
+	}
+}
+
+func TestParseWinDim(t *testing.T) {
+	out := `
+  Absolute upper-left X:  -1280
+  Absolute upper-left Y:  -4
+  Relative upper-left X:  3
+  Relative upper-left Y:  25
+  Width: 640
+  Height: 480
+`
+	for _, test := range []struct {
+		name string
+		want int
+	}{{"X", -1280}, {"Y", -4}, {"W", 640}, {"H", 480}} {
+		rx := map[string]*regexp.Regexp{"X": xRx, "Y": yRx, "W": wRx, "H": hRx}[test.name]
+		got, err := parseWinDim(rx, out, test.name)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+	if _, err := parseWinDim(xRx, "xwininfo: error: No such window", "X"); err == nil {
+		t.Error("got no error for output without dimensions")
+	}
+}
+
+func TestParseWmctrlList(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want []*Window
+	}{{
+		name: "aligned columns",
+		out: "0x01e00003  0 1234   Navigator.firefox     thinkpad Mozilla Firefox\n" +
+			"0x02400003 -1 3456   xclock.XClock         N/A       two  spaces \n" +
+			"0x02600003  2 0      N/A                   N/A      N/A\n" +
+			"0x02800003  0 1111   N/A                   thinkpad unity-panel\n",
+		want: []*Window{
+			{ID: 0x1e00003, Desktop: 0, PID: 1234, Instance: "Navigator", Class: "firefox", Name: "Mozilla Firefox"},
+			{ID: 0x2400003, Desktop: -1, PID: 3456, Instance: "xclock", Class: "XClock", Name: " two  spaces "},
+			{ID: 0x2600003, Desktop: 2, PID: 0, Name: "N/A"},
+		},
+	}, {
+		name: "unaligned columns",
+		out: "0x01e00003 0 1 a.A host x   y\n" +
+			"0x01e00004 0 1 a.A longerhost z\n",
+		want: []*Window{
+			{ID: 0x1e00003, PID: 1, Instance: "a", Class: "A", Name: "x   y"},
+			{ID: 0x1e00004, PID: 1, Instance: "a", Class: "A", Name: "z"},
+		},
+	}, {
+		name: "dotted class",
+		out:  "0x01e00003  0 1  org.gnome.Nautilus.Org.gnome.Nautilus  host Home\n",
+		want: []*Window{
+			{ID: 0x1e00003, PID: 1, Instance: "org.gnome.Nautilus", Class: "Org.gnome.Nautilus", Name: "Home"},
+		},
+	}, {
+		name: "no title",
+		out:  "0x01e00003  0 1  a.A  host\n",
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseWmctrlList(test.out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got\n%s\nwant\n%s", windowsString(got), windowsString(test.want))
+			}
+		})
+	}
+	if _, err := parseWmctrlList("zzz  0 1  a.A  host title\n"); err == nil {
+		t.Error("got no error for an invalid window ID")
+	}
+}
+
+func TestParseWmctrlDesktops(t *testing.T) {
+	tests := []struct {
+		out          string
+		wantCurrent  int64
+		wantDesktops []*Desktop
+	}{{
+		out: "0  - DG: 1920x1080  VP: 0,0  WA: 0,25 1920x1055  review\n" +
+			"1  * DG: 1920x1080  VP: N/A  WA: N/A  on   call\n" +
+			"2  - DG: N/A  VP: N/A  WA: N/A  N/A\n",
+		wantCurrent:  1,
+		wantDesktops: []*Desktop{{ID: 0, Name: "review"}, {ID: 1, Name: "on   call"}, {ID: 2, Name: "N/A"}},
+	}, {
+		out:          "0  * DG: 1920x1080  VP: 0,0  WA: 0,25 1920x1055\n",
+		wantDesktops: []*Desktop{{ID: 0}},
+	}, {
+		out: "",
+	}}
+	for _, test := range tests {
+		current, desktops, err := parseWmctrlDesktops(test.out)
+		if err != nil {
+			t.Errorf("%q: %s", test.out, err)
+			continue
+		}
+		if current != test.wantCurrent || !reflect.DeepEqual(desktops, test.wantDesktops) {
+			t.Errorf("%q: got %d, %+v, want %d, %+v", test.out, current, desktops, test.wantCurrent, test.wantDesktops)
+		}
+	}
+}
+
+// withoutExe clears the Exe of windows, which depends on the
+// processes that happen to be running where the tests run, and
+// returns them.
+func withoutExe(windows []*Window) []*Window {
+	for _, w := range windows {
+		w.Exe = ""
+	}
+	return windows
+}
+
+func windowsString(windows []*Window) string {
+	var lines []string
+	for _, w := range windows {
+		s := fmt.Sprintf("%+v", *w)
+		if w.Geometry != nil {
+			s += fmt.Sprintf(" Geometry:%+v", *w.Geometry)
+		}
+		lines = append(lines, s)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -3,6 +3,7 @@ package thyme
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"text/template"
@@ -11,24 +12,60 @@ import (
 
 const maxNumberOfBars = 30
 
+// awayLabel is the label given to the active window while the user
+// is away (see Snapshot.IsAway).
+const awayLabel = "Away"
+
+// gapLabel is the label given to the active window for time the
+// Tracker couldn't record (see Snapshot.IsGap).
+const gapLabel = "No data"
+
 // Stats renders an HTML page with charts using stream as its data
 // source. Currently, it renders the following charts:
 // 1. A timeline of applications active, visible, and open
 // 2. A timeline of windows active, visible, and open
 // 3. A barchart of applications most often active, visible, and open
-func Stats(stream *Stream) error {
-	tlFine := NewTimeline(stream, func(w *Window) string { return w.Name })
-	tlCoarse := NewTimeline(stream, appID)
-	agg := NewAggTime(stream, appID)
-
-	if err := statsTmpl.Execute(os.Stdout, &statsPage{
-		Fine:   tlFine,
-		Coarse: tlCoarse,
-		Agg:    agg,
-	}); err != nil {
-		return err
+// 4. A barchart of the workspaces used most often, if recorded
+//
+// Snapshots taken after the user had been idle for longer than
+// idleThreshold count as "Away" rather than as time spent in the
+// active window. An idleThreshold of zero disables this.
+func Stats(stream *Stream, idleThreshold time.Duration) error {
+	return statsTmpl.Execute(os.Stdout, newStatsPage(stream, idleThreshold))
+}
+
+// newStatsPage returns the data for the page rendered by Stats,
+// leaving out or annotating whatever the Trackers that recorded stream
+// couldn't record (see Stream.Capabilities).
+func newStatsPage(stream *Stream, idleThreshold time.Duration) *statsPage {
+	page := &statsPage{
+		Fine:   NewTimeline(stream, func(w *Window) string { return w.Name }, idleThreshold),
+		Coarse: NewTimeline(stream, appID, idleThreshold),
+		Agg:    NewAggTime(stream, appID, idleThreshold),
+	}
+	caps := stream.Supported()
+	if !caps.Visibility {
+		for _, tl := range []*Timeline{page.Fine, page.Coarse} {
+			if tl != nil {
+				delete(tl.Rows, "Visible")
+			}
+		}
+		page.Agg.RemoveChart("Visible")
+		page.Notes = append(page.Notes, "The tracker that recorded this data can't tell which windows are visible, so visible windows aren't shown.")
+	}
+	if !caps.Idle && idleThreshold > 0 {
+		page.Notes = append(page.Notes, "The tracker that recorded this data can't detect when you're away, so time away from the computer counts towards the active application.")
+	}
+	if wt := NewWorkspaceTime(stream, idleThreshold); wt != nil {
+		page.Agg.Charts = append(page.Agg.Charts, wt.Chart())
+	} else {
+		page.Notes = append(page.Notes, "The tracker that recorded this data doesn't record the current workspace, so time per workspace isn't shown.")
 	}
-	return nil
+	if gaps := stream.Gaps(); gaps > 0 {
+		n := len(stream.Snapshots)
+		page.Notes = append(page.Notes, fmt.Sprintf("%d of %d samples (%.1f%%) couldn't be taken. The time after each of them is shown as %q in the timelines and left out of the bar charts.", gaps, n, 100*float64(gaps)/float64(n), gapLabel))
+	}
+	return page
 }
 
 // AggTime is the list of bar charts that convey aggregate application time usage.
@@ -36,23 +73,37 @@ type AggTime struct {
 	Charts []*BarChart
 }
 
-// NewAggTime returns a new AggTime created from a Stream.
-func NewAggTime(stream *Stream, labelFunc func(*Window) string) *AggTime {
+// NewAggTime returns a new AggTime created from a Stream. Snapshots
+// where the user was away (see Snapshot.IsAway) count towards
+// "Away" instead of the active application. Gap markers (see
+// Snapshot.IsGap) aren't counted. Each visible window counts towards
+// the "Visible" chart in proportion to how much of it was seen (see
+// Snapshot.VisibleFraction).
+func NewAggTime(stream *Stream, labelFunc func(*Window) string, idleThreshold time.Duration) *AggTime {
 	n := strconv.Itoa(maxNumberOfBars)
 	active := NewBarChart("Active", "App", "Samples", "Top "+n+" active applications by time (multiplied by window count)")
-	visible := NewBarChart("Visible", "App", "Samples", "Top "+n+" visible applications by time (multiplied by window count)")
+	visible := NewBarChart("Visible", "App", "Samples", "Top "+n+" visible applications by time (multiplied by window count, weighted by visible area)")
 	all := NewBarChart("All", "App", "Samples", "Top "+n+" open applications by time (multiplied by window count)")
 	for _, snap := range stream.Snapshots {
+		if snap.IsGap() {
+			continue
+		}
 		windows := make(map[int64]*Window)
 		for _, win := range snap.Windows {
 			windows[win.ID] = win
 		}
 
-		if win := windows[snap.Active]; win != nil {
+		if snap.IsAway(idleThreshold) {
+			active.Plus(awayLabel, 1)
+		} else if win := windows[snap.Active]; win != nil {
 			active.Plus(labelFunc(windows[snap.Active]), 1)
 		}
 		for _, v := range snap.Visible {
-			visible.Plus(labelFunc(windows[v]), 1)
+			fraction, ok := snap.VisibleFraction[v]
+			if !ok {
+				fraction = 1
+			}
+			visible.Plus(labelFunc(windows[v]), fraction)
 		}
 		for _, win := range snap.Windows {
 			all.Plus(labelFunc(win), 1)
@@ -61,29 +112,40 @@ func NewAggTime(stream *Stream, labelFunc func(*Window) string) *AggTime {
 	return &AggTime{Charts: []*BarChart{active, visible, all}}
 }
 
+// RemoveChart removes the chart with the specified ID, if present.
+func (a *AggTime) RemoveChart(id string) {
+	charts := a.Charts[:0]
+	for _, c := range a.Charts {
+		if c.ID != id {
+			charts = append(charts, c)
+		}
+	}
+	a.Charts = charts
+}
+
 // BarChart is a representation of a bar chart.
 type BarChart struct {
 	ID     string
 	YLabel string
 	XLabel string
 	Title  string
-	Series map[string]int
+	Series map[string]float64
 }
 
 // Bar represents a single bar in a bar chart.
 type Bar struct {
 	Label string
-	Count int
+	Count float64
 }
 
 // NewBarChart returns a new BarChart with the specified ID, x- and
 // y-axis label, and title.
 func NewBarChart(id, x, y, title string) *BarChart {
-	return &BarChart{ID: id, XLabel: x, YLabel: y, Title: title, Series: make(map[string]int)}
+	return &BarChart{ID: id, XLabel: x, YLabel: y, Title: title, Series: make(map[string]float64)}
 }
 
 // Plus adds n to the count associated with the label.
-func (c *BarChart) Plus(label string, n int) {
+func (c *BarChart) Plus(label string, n float64) {
 	c.Series[label] += n
 }
 
@@ -134,7 +196,12 @@ type Range struct {
 // a given Window. If you're tracking events by app, this ID should
 // reflect the identity of the window's application. If you're
 // tracking events by window name, the ID should be the window name.
-func NewTimeline(stream *Stream, labelFunc func(*Window) string) *Timeline {
+// While the user is away (see Snapshot.IsAway), the active row is
+// labeled "Away" instead of with the active window. Likewise, the
+// active row is labeled "No data" from each gap marker (see
+// Snapshot.IsGap) until the next snapshot, and the other rows are
+// broken there.
+func NewTimeline(stream *Stream, labelFunc func(*Window) string, idleThreshold time.Duration) *Timeline {
 	if len(stream.Snapshots) == 0 {
 		return nil
 	}
@@ -148,8 +215,16 @@ func NewTimeline(stream *Stream, labelFunc func(*Window) string) *Timeline {
 		}
 
 		{
-			if win := windows[snap.Active]; win != nil {
-				winLabel := labelFunc(win)
+			var winLabel string
+			var hasActive bool
+			if snap.IsGap() {
+				winLabel, hasActive = gapLabel, true
+			} else if snap.IsAway(idleThreshold) {
+				winLabel, hasActive = awayLabel, true
+			} else if win := windows[snap.Active]; win != nil {
+				winLabel, hasActive = labelFunc(win), true
+			}
+			if hasActive {
 				if lastActive != nil && lastActive.Label == winLabel {
 					lastActive.End = snap.Time
 				} else {
@@ -218,6 +293,10 @@ type statsPage struct {
 	Fine   *Timeline
 	Coarse *Timeline
 	Agg    *AggTime
+
+	// Notes explain gaps in the data, e.g., because the tracker
+	// couldn't record something.
+	Notes []string
 }
 
 // statsTmpl is the HTML template for the page rendered by the `Stats`
@@ -371,6 +450,10 @@ var statsTmpl = template.Must(template.New("").Funcs(map[string]interface{}{
   </head>
   <body>
 
+	{{range .Notes}}
+	<div class="description">Note: {{.}}</div>
+	{{end}}
+
 	<div class="description">
 		This is a coarse-grained timeline of all the applications you use over the course of the day. Every bar represents an application.
 	</div>
@@ -392,12 +475,21 @@ var statsTmpl = template.Must(template.New("").Funcs(map[string]interface{}{
 </html>`))
 
 // appID returns a string that identifies the application of the
-// window, w. It does so in best effort fashion. If the application
-// can't be determined, it returns the the name of the window.
+// window, w. It does so in best effort fashion. It prefers the
+// identifiers the windowing system reports for the application (see
+// Window.Class and Window.Exe), and falls back to guessing from the
+// window's title. If the application can't be determined, it returns
+// the the name of the window.
 func appID(w *Window) string {
 	if w == nil {
 		return "(nil)"
 	}
+	if w.Class != "" {
+		return w.Class
+	}
+	if w.Exe != "" {
+		return filepath.Base(w.Exe)
+	}
 	if w.Info().App != "" {
 		return w.Info().App
 	}
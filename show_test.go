@@ -0,0 +1,178 @@
+package thyme
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsCapabilities(t *testing.T) {
+	start := time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)
+	desktop := int64(0)
+	snapshots := func(current *int64) []*Snapshot {
+		var snapshots []*Snapshot
+		for i := 0; i < 3; i++ {
+			snapshots = append(snapshots, &Snapshot{
+				Time:           start.Add(time.Duration(i) * time.Minute),
+				Windows:        []*Window{{ID: 1, Name: "Mozilla Firefox"}, {ID: 2, Name: "vim notes.txt"}},
+				Active:         2,
+				Visible:        []int64{1, 2},
+				CurrentDesktop: current,
+			})
+		}
+		return snapshots
+	}
+	tests := []struct {
+		name          string
+		caps          *Capabilities
+		threshold     time.Duration
+		noDesktop     bool
+		wantVisible   bool
+		wantWorkspace bool
+		wantNotes     int
+	}{
+		{"recorded by an older version", nil, time.Minute, false, true, true, 0},
+		{"all", &Capabilities{Visibility: true, Idle: true}, time.Minute, false, true, true, 0},
+		{"no visibility", &Capabilities{Idle: true}, time.Minute, false, false, true, 1},
+		{"no idle", &Capabilities{Visibility: true}, time.Minute, false, true, true, 1},
+		// Without an idle threshold, idle times aren't used.
+		{"no idle without a threshold", &Capabilities{Visibility: true}, 0, false, true, true, 0},
+		{"no current desktop", &Capabilities{Visibility: true, Idle: true}, time.Minute, true, true, false, 1},
+		{"none", &Capabilities{}, time.Minute, true, false, false, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current := &desktop
+			if test.noDesktop {
+				current = nil
+			}
+			page := newStatsPage(&Stream{Snapshots: snapshots(current), Capabilities: test.caps}, test.threshold)
+
+			for _, tl := range []*Timeline{page.Fine, page.Coarse} {
+				if _, ok := tl.Rows["Visible"]; ok != test.wantVisible {
+					t.Errorf("got Visible timeline row %v, want %v", ok, test.wantVisible)
+				}
+			}
+			charts := map[string]bool{}
+			for _, c := range page.Agg.Charts {
+				charts[c.ID] = true
+			}
+			if charts["Visible"] != test.wantVisible {
+				t.Errorf("got charts %v, want Visible chart %v", charts, test.wantVisible)
+			}
+			if charts["Workspace"] != test.wantWorkspace {
+				t.Errorf("got charts %v, want Workspace chart %v", charts, test.wantWorkspace)
+			}
+
+			if len(page.Notes) != test.wantNotes {
+				t.Errorf("got notes %q, want %d", page.Notes, test.wantNotes)
+			}
+		})
+	}
+}
+
+// gapStream returns a stream in which vim is active, then a sample
+// fails, and vim is active again three minutes later.
+func gapStream() *Stream {
+	start := time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)
+	sample := func(d time.Duration) *Snapshot {
+		return &Snapshot{Time: start.Add(d), Windows: []*Window{{ID: 1, Name: "vim notes.txt"}}, Active: 1, Visible: []int64{1}}
+	}
+	return &Stream{Snapshots: []*Snapshot{
+		sample(0),
+		sample(time.Minute),
+		NewGap(start.Add(2*time.Minute), errors.New("xdotool failed")),
+		sample(5 * time.Minute),
+	}}
+}
+
+func TestTimelineGap(t *testing.T) {
+	stream := gapStream()
+	at := func(i int) time.Time { return stream.Snapshots[i].Time }
+	tl := NewTimeline(stream, func(w *Window) string { return w.Name }, 0)
+
+	// The time after the gap marker isn't attributed to vim, which
+	// was active before it.
+	want := map[string][]*Range{
+		"Active": {
+			{Label: "vim notes.txt", Start: at(0), End: at(2)},
+			{Label: gapLabel, Start: at(2), End: at(3)},
+			{Label: "vim notes.txt", Start: at(3), End: at(3)},
+		},
+		"Visible": {
+			{Label: "vim notes.txt", Start: at(0), End: at(2)},
+			{Label: "vim notes.txt", Start: at(3), End: at(3)},
+		},
+		"All": {
+			{Label: "vim notes.txt", Start: at(0), End: at(2)},
+			{Label: "vim notes.txt", Start: at(3), End: at(3)},
+		},
+	}
+	for row, ranges := range want {
+		if got := tl.Rows[row]; !reflect.DeepEqual(got, ranges) {
+			t.Errorf("%s: got ranges %s, want %s", row, rangesString(got), rangesString(ranges))
+		}
+	}
+}
+
+func TestAggTimeGap(t *testing.T) {
+	agg := NewAggTime(gapStream(), func(w *Window) string { return w.Name }, 0)
+	for _, c := range agg.Charts {
+		if want := map[string]float64{"vim notes.txt": 3}; !reflect.DeepEqual(c.Series, want) {
+			t.Errorf("%s: got %v, want %v", c.ID, c.Series, want)
+		}
+	}
+}
+
+func TestAggTimeVisibleFraction(t *testing.T) {
+	start := time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)
+	windows := []*Window{{ID: 1, Name: "vim notes.txt"}, {ID: 2, Name: "xclock"}}
+	stream := &Stream{Snapshots: []*Snapshot{
+		// xclock covers a quarter of vim.
+		{Time: start, Windows: windows, Active: 1, Visible: []int64{1, 2}, VisibleFraction: map[int64]float64{1: 0.75, 2: 1}},
+		// Recorded without the stacking order.
+		{Time: start.Add(time.Minute), Windows: windows, Active: 1, Visible: []int64{1, 2}},
+	}}
+	agg := NewAggTime(stream, func(w *Window) string { return w.Name }, 0)
+	want := map[string]map[string]float64{
+		"Active":  {"vim notes.txt": 2},
+		"Visible": {"vim notes.txt": 1.75, "xclock": 2},
+		"All":     {"vim notes.txt": 2, "xclock": 2},
+	}
+	for _, c := range agg.Charts {
+		if !reflect.DeepEqual(c.Series, want[c.ID]) {
+			t.Errorf("%s: got %v, want %v", c.ID, c.Series, want[c.ID])
+		}
+	}
+}
+
+func rangesString(ranges []*Range) string {
+	var s []string
+	for _, r := range ranges {
+		s = append(s, fmt.Sprintf("%q %s-%s", r.Label, r.Start.Format("15:04"), r.End.Format("15:04")))
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
+
+func TestAppID(t *testing.T) {
+	tests := []struct {
+		name   string
+		window *Window
+		want   string
+	}{
+		{"class", &Window{Name: "main.go - thyme - Visual Studio Code", Class: "Code", Exe: "/usr/share/code/code"}, "Code"},
+		{"executable", &Window{Name: "main.go - thyme - Visual Studio Code", Exe: "/usr/share/code/code"}, "code"},
+		{"name", &Window{Name: "main.go - thyme - Visual Studio Code"}, "Visual Studio Code"},
+		{"nil", nil, "(nil)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := appID(test.window); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
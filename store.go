@@ -0,0 +1,85 @@
+package thyme
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// stores is the list of Store constructors that are available. Store implementations should call the RegisterStore
+// function to make themselves available.
+var stores = make(map[string]func(path string) (Store, error))
+
+// RegisterStore makes a Store constructor available to clients of this package. It panics if a Store has already been
+// registered with the same name, as that is a programming error.
+func RegisterStore(name string, s func(path string) (Store, error)) {
+	if _, exists := stores[name]; exists {
+		panic(fmt.Sprintf("a store already exists with the name %s", name))
+	}
+	stores[name] = s
+}
+
+// OpenStore opens the data stored at path with the Store whose type
+// is `name`.
+func OpenStore(name, path string) (Store, error) {
+	if _, exists := stores[name]; !exists {
+		return nil, fmt.Errorf("no Store constructor has been registered with name %s", name)
+	}
+	return stores[name](path)
+}
+
+// Stores returns the names of all registered Store types in
+// alphabetical order.
+func Stores() []string {
+	names := make([]string, 0, len(stores))
+	for name := range stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Store persists the snapshots recorded by a Tracker.
+type Store interface {
+	// SetCapabilities records caps as the Capabilities of the
+	// Tracker whose snapshots are appended to the store from now on
+	// (see Stream.Capabilities). It only writes to the store if the
+	// stored capabilities change.
+	SetCapabilities(caps Capabilities) error
+
+	// Append adds snap to the end of the store.
+	Append(snap *Snapshot) error
+
+	// Range returns a Stream of the stored snapshots taken at or
+	// after since and before until, ordered by the time they were
+	// taken. Snapshots taken at the same time are ordered as they
+	// were appended. A zero since or until leaves that end of the
+	// range unbounded.
+	Range(since, until time.Time) (*Stream, error)
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// inRange returns true if t is within the range described by
+// Store.Range.
+func inRange(t, since, until time.Time) bool {
+	return (since.IsZero() || !t.Before(since)) && (until.IsZero() || t.Before(until))
+}
+
+// filterRange returns a Stream of the snapshots in stream that are
+// within the range described by Store.Range, in the order described
+// there. Stores that don't index snapshots by time use it to
+// implement Range.
+func filterRange(stream *Stream, since, until time.Time) *Stream {
+	filtered := Stream{Capabilities: stream.Capabilities}
+	for _, snap := range stream.Snapshots {
+		if inRange(snap.Time, since, until) {
+			filtered.Snapshots = append(filtered.Snapshots, snap)
+		}
+	}
+	sort.SliceStable(filtered.Snapshots, func(i, j int) bool {
+		return filtered.Snapshots[i].Time.Before(filtered.Snapshots[j].Time)
+	})
+	return &filtered
+}
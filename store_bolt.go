@@ -0,0 +1,167 @@
+package thyme
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+func init() {
+	RegisterStore("bolt", NewBoltStore)
+}
+
+// snapshotsBucket is the name of the bolt bucket holding snapshots.
+var snapshotsBucket = []byte("snapshots")
+
+// metaBucket is the name of the bolt bucket holding the stream's
+// metadata, which is stored under the name of the Stream field it
+// belongs in.
+var (
+	metaBucket      = []byte("meta")
+	capabilitiesKey = []byte("Capabilities")
+)
+
+// BoltStore stores snapshots in an embedded bolt key-value
+// database. Snapshots are keyed by the time they were taken, so
+// Range only reads the snapshots it returns.
+//
+// The database is opened for the duration of each operation rather
+// than for the lifetime of the store, because bolt holds an exclusive
+// lock on the database file while it is open, which would prevent
+// `thyme show` from reading data written by a running `thyme daemon`.
+type BoltStore struct {
+	path string
+}
+
+var _ Store = (*BoltStore)(nil)
+
+func NewBoltStore(path string) (Store, error) {
+	return &BoltStore{path: path}, nil
+}
+
+func (s *BoltStore) SetCapabilities(caps Capabilities) error {
+	return s.withDB(false, func(db *bolt.DB) error {
+		return db.Update(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(metaBucket)
+			if err != nil {
+				return err
+			}
+			var stream Stream
+			if err := readCapabilities(b, &stream); err != nil {
+				return err
+			}
+			if c := stream.Capabilities; c != nil && c.Intersect(caps) == *c {
+				return nil
+			}
+			stream.addCapabilities(caps)
+			val, err := json.Marshal(stream.Capabilities)
+			if err != nil {
+				return err
+			}
+			return b.Put(capabilitiesKey, val)
+		})
+	})
+}
+
+func (s *BoltStore) Append(snap *Snapshot) error {
+	val, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return s.withDB(false, func(db *bolt.DB) error {
+		return db.Update(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(snapshotsBucket)
+			if err != nil {
+				return err
+			}
+			// Keys must be unique, so nudge the key forward if
+			// another snapshot was taken at the same nanosecond.
+			key := timeKey(snap.Time)
+			for b.Get(key) != nil {
+				binary.BigEndian.PutUint64(key, binary.BigEndian.Uint64(key)+1)
+			}
+			return b.Put(key, val)
+		})
+	})
+}
+
+func (s *BoltStore) Range(since, until time.Time) (*Stream, error) {
+	var stream Stream
+	err := s.withDB(true, func(db *bolt.DB) error {
+		return db.View(func(tx *bolt.Tx) error {
+			if meta := tx.Bucket(metaBucket); meta != nil {
+				if err := readCapabilities(meta, &stream); err != nil {
+					return err
+				}
+			}
+			b := tx.Bucket(snapshotsBucket)
+			if b == nil {
+				return nil
+			}
+			c := b.Cursor()
+			k, v := c.First()
+			if !since.IsZero() {
+				k, v = c.Seek(timeKey(since))
+			}
+			for ; k != nil; k, v = c.Next() {
+				var snap Snapshot
+				if err := json.Unmarshal(v, &snap); err != nil {
+					return err
+				}
+				if !until.IsZero() && !snap.Time.Before(until) {
+					break
+				}
+				stream.Snapshots = append(stream.Snapshots, &snap)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stream, nil
+}
+
+func (s *BoltStore) Close() error {
+	return nil
+}
+
+// boltTimeout is how long withDB waits for another process to close
+// the database before giving up.
+var boltTimeout = 5 * time.Second
+
+// withDB opens the database, calls f, and closes the database.
+func (s *BoltStore) withDB(readOnly bool, f func(db *bolt.DB) error) error {
+	db, err := bolt.Open(s.path, 0644, &bolt.Options{ReadOnly: readOnly, Timeout: boltTimeout})
+	if err == bolt.ErrTimeout {
+		return fmt.Errorf("store %s is in use: another process has held it open for more than %s", s.path, boltTimeout)
+	} else if err != nil {
+		return err
+	}
+	if err := f(db); err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+// readCapabilities sets stream.Capabilities to the capabilities stored
+// in the meta bucket b, if any.
+func readCapabilities(b *bolt.Bucket, stream *Stream) error {
+	val := b.Get(capabilitiesKey)
+	if val == nil {
+		return nil
+	}
+	return json.Unmarshal(val, &stream.Capabilities)
+}
+
+// timeKey returns the bolt key for a snapshot taken at t. Keys sort
+// in time order for all times between 1970 and 2262.
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
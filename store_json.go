@@ -0,0 +1,88 @@
+package thyme
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+func init() {
+	RegisterStore("json", NewJSONStore)
+}
+
+// JSONStore stores snapshots in the legacy format: a file containing
+// a single JSON-encoded Stream. Every append reads and rewrites the
+// whole file, so prefer JSONLStore unless the file must be read by
+// older versions of Thyme.
+type JSONStore struct {
+	path string
+}
+
+var _ Store = (*JSONStore)(nil)
+
+func NewJSONStore(path string) (Store, error) {
+	return &JSONStore{path: path}, nil
+}
+
+func (s *JSONStore) SetCapabilities(caps Capabilities) error {
+	return s.update(func(stream *Stream) bool {
+		if c := stream.Capabilities; c != nil && c.Intersect(caps) == *c {
+			return false
+		}
+		stream.addCapabilities(caps)
+		return true
+	})
+}
+
+func (s *JSONStore) Append(snap *Snapshot) error {
+	return s.update(func(stream *Stream) bool {
+		stream.Snapshots = append(stream.Snapshots, snap)
+		return true
+	})
+}
+
+func (s *JSONStore) Range(since, until time.Time) (*Stream, error) {
+	stream, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return filterRange(stream, since, until), nil
+}
+
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+// update reads the stream from the file, calls f to modify it, and
+// rewrites the file if f returns true, all while holding the file's
+// lock.
+func (s *JSONStore) update(f func(stream *Stream) bool) error {
+	lock, err := LockFile(s.path)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	stream, err := s.read()
+	if os.IsNotExist(err) {
+		stream = &Stream{}
+	} else if err != nil {
+		return err
+	}
+	if !f(stream) {
+		return nil
+	}
+	return WriteFileAtomic(s.path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(stream)
+	})
+}
+
+func (s *JSONStore) read() (*Stream, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeStream(f)
+}
@@ -0,0 +1,52 @@
+package thyme
+
+import (
+	"os"
+	"time"
+)
+
+func init() {
+	RegisterStore("jsonl", NewJSONLStore)
+}
+
+// JSONLStore stores snapshots in a file with one JSON-encoded
+// Snapshot per line. Appending a snapshot writes a single line
+// without reading or rewriting the rest of the file (but setting the
+// capabilities reads the whole file; see AppendCapabilitiesFile).
+// Files written in
+// the legacy format (see JSONStore) can be read, and appended to, as
+// well.
+type JSONLStore struct {
+	path string
+}
+
+var _ Store = (*JSONLStore)(nil)
+
+func NewJSONLStore(path string) (Store, error) {
+	return &JSONLStore{path: path}, nil
+}
+
+func (s *JSONLStore) SetCapabilities(caps Capabilities) error {
+	return AppendCapabilitiesFile(s.path, caps)
+}
+
+func (s *JSONLStore) Append(snap *Snapshot) error {
+	return AppendSnapshotFile(s.path, snap)
+}
+
+func (s *JSONLStore) Range(since, until time.Time) (*Stream, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stream, err := DecodeStream(f)
+	if err != nil {
+		return nil, err
+	}
+	return filterRange(stream, since, until), nil
+}
+
+func (s *JSONLStore) Close() error {
+	return nil
+}
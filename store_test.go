@@ -0,0 +1,195 @@
+package thyme
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// actives returns the Active field of every snapshot in stream, which
+// the tests below use to tell snapshots apart.
+func actives(stream *Stream) []int64 {
+	var ids []int64
+	for _, snap := range stream.Snapshots {
+		ids = append(ids, snap.Active)
+	}
+	return ids
+}
+
+func TestStores(t *testing.T) {
+	start := time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)
+	at := func(sec int) time.Time { return start.Add(time.Duration(sec) * time.Second) }
+
+	// Snapshot 3 was taken before snapshot 2 (e.g., because the
+	// clock was set back), and snapshots 4 and 5 at the same time.
+	appended := []*Snapshot{
+		{Time: at(0), Active: 1},
+		{Time: at(60), Active: 2},
+		{Time: at(30), Active: 3},
+		{Time: at(90), Active: 4},
+		{Time: at(90), Active: 5},
+		{Time: at(120), Active: 6},
+	}
+	ranges := []struct {
+		name         string
+		since, until time.Time
+		want         []int64
+	}{
+		{"all", time.Time{}, time.Time{}, []int64{1, 3, 2, 4, 5, 6}},
+		{"since", at(60), time.Time{}, []int64{2, 4, 5, 6}},
+		{"until", time.Time{}, at(60), []int64{1, 3}},
+		{"since and until", at(30), at(120), []int64{3, 2, 4, 5}},
+		{"equal times", at(90), at(91), []int64{4, 5}},
+		{"empty", at(121), time.Time{}, nil},
+	}
+
+	for _, name := range Stores() {
+		t.Run(name, func(t *testing.T) {
+			path := tempDataFile(t)
+			store, err := OpenStore(name, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, snap := range appended[:3] {
+				if err := store.Append(snap); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Reopen the store and append to the existing data.
+			store, err = OpenStore(name, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			for _, snap := range appended[3:] {
+				if err := store.Append(snap); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, r := range ranges {
+				stream, err := store.Range(r.since, r.until)
+				if err != nil {
+					t.Fatalf("%s: %s", r.name, err)
+				}
+				if got := actives(stream); !reflect.DeepEqual(got, r.want) {
+					t.Errorf("%s: got snapshots %v, want %v", r.name, got, r.want)
+				}
+				for _, snap := range stream.Snapshots {
+					if want := appended[snap.Active-1].Time; !snap.Time.Equal(want) {
+						t.Errorf("%s: snapshot %d has time %s, want %s", r.name, snap.Active, snap.Time, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestOpenStoreUnknown(t *testing.T) {
+	if _, err := OpenStore("csv", tempDataFile(t)); err == nil {
+		t.Error("got no error opening an unregistered store")
+	}
+}
+
+func TestBoltStoreInUse(t *testing.T) {
+	defer func(timeout time.Duration) { boltTimeout = timeout }(boltTimeout)
+	boltTimeout = 10 * time.Millisecond
+
+	path := tempDataFile(t)
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Append(&Snapshot{Time: time.Now()})
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("got error %v, want an error saying the store is in use", err)
+	}
+}
+
+func TestStoresCapabilities(t *testing.T) {
+	for _, name := range Stores() {
+		t.Run(name, func(t *testing.T) {
+			store, err := OpenStore(name, tempDataFile(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			if err := store.Append(&Snapshot{Time: time.Now(), Active: 1}); err != nil {
+				t.Fatal(err)
+			}
+			stream, err := store.Range(time.Time{}, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stream.Capabilities != nil {
+				t.Errorf("got capabilities %+v before any were set", *stream.Capabilities)
+			}
+
+			steps := []struct {
+				set, want Capabilities
+			}{
+				{Capabilities{Visibility: true, Idle: true}, Capabilities{Visibility: true, Idle: true}},
+				{Capabilities{Visibility: true, Idle: true}, Capabilities{Visibility: true, Idle: true}},
+				// A Tracker without idle support takes over.
+				{Capabilities{Visibility: true}, Capabilities{Visibility: true}},
+				{Capabilities{Visibility: true, Idle: true}, Capabilities{Visibility: true}},
+			}
+			for i, step := range steps {
+				if err := store.SetCapabilities(step.set); err != nil {
+					t.Fatal(err)
+				}
+				if err := store.Append(&Snapshot{Time: time.Now(), Active: int64(i + 2)}); err != nil {
+					t.Fatal(err)
+				}
+				stream, err := store.Range(time.Time{}, time.Time{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stream.Capabilities == nil || *stream.Capabilities != step.want {
+					t.Errorf("after setting %+v: got capabilities %+v, want %+v", step.set, stream.Capabilities, step.want)
+				}
+				if n := len(stream.Snapshots); n != i+2 {
+					t.Errorf("after setting %+v: got %d snapshots, want %d", step.set, n, i+2)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONLStoreCapabilitiesOnce(t *testing.T) {
+	path := tempDataFile(t)
+	store, err := NewJSONLStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := Capabilities{Visibility: true}
+	for i := 0; i < 3; i++ {
+		if err := store.SetCapabilities(caps); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Append(&Snapshot{Time: time.Now(), Active: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), `"Capabilities"`); n != 1 {
+		t.Errorf("got %d headers, want 1 in\n%s", n, data)
+	}
+}
@@ -0,0 +1,109 @@
+package thyme
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+func init() {
+	RegisterTracker("sway", NewSwayTracker)
+}
+
+// SwayTracker tracks application usage in the sway Wayland compositor (https://swaywm.org) by requesting the layout
+// tree over sway's IPC socket. Unlike the trackers built on X11 utilities, it sees native Wayland windows as well as
+// Xwayland ones.
+type SwayTracker struct{}
+
+var _ Tracker = (*SwayTracker)(nil)
+
+func NewSwayTracker() Tracker {
+	return &SwayTracker{}
+}
+
+func (t *SwayTracker) Capabilities() Capabilities {
+	return Capabilities{Visibility: true}
+}
+
+func (t *SwayTracker) Deps() string {
+	return `
+No external programs are required, but Thyme must run inside a sway session so that the SWAYSOCK environment
+variable points to sway's IPC socket.
+
+Note: this command prints out this message regardless of whether the dependencies are already installed. Run
+"thyme dep --check" to check which ones are.
+`
+}
+
+func (t *SwayTracker) CheckDeps() []*Dependency {
+	return []*Dependency{
+		checkProbe("sway IPC socket", t.Probe, map[string]string{
+			"all": "run Thyme inside a sway session",
+		}),
+	}
+}
+
+func (t *SwayTracker) Probe() error {
+	if err := requireEnv("SWAYSOCK"); err != nil {
+		return err
+	}
+	return requireSocket(os.Getenv("SWAYSOCK"))
+}
+
+func (t *SwayTracker) Snap(ctx context.Context) (*Snapshot, error) {
+	socket := os.Getenv("SWAYSOCK")
+	if socket == "" {
+		return nil, fmt.Errorf("SWAYSOCK is not set. Is sway running?")
+	}
+	var tree ipcNode
+	if err := ipcRequest(ctx, socket, ipcGetTree, &tree); err != nil {
+		return nil, fmt.Errorf("sway GET_TREE request failed with error: %s. Try running `swaymsg -t get_tree` to diagnose.", err)
+	}
+	var workspaces []*ipcWorkspace
+	if err := ipcRequest(ctx, socket, ipcGetWorkspaces, &workspaces); err != nil {
+		return nil, fmt.Errorf("sway GET_WORKSPACES request failed with error: %s. Try running `swaymsg -t get_workspaces` to diagnose.", err)
+	}
+	snap := swaySnapshot(&tree, workspaces)
+	snap.Time = time.Now()
+	setVisibleFractions(snap, treeStacking(snap.Windows))
+	return snap, nil
+}
+
+// swaySnapshot converts a sway layout tree and workspace list into a
+// Snapshot.
+func swaySnapshot(tree *ipcNode, workspaces []*ipcWorkspace) *Snapshot {
+	var snap Snapshot
+	for _, ws := range workspaces {
+		snap.Desktops = append(snap.Desktops, &Desktop{ID: ws.desktop(), Name: ws.Name})
+		if ws.Focused {
+			current := ws.desktop()
+			snap.CurrentDesktop = &current
+		}
+	}
+	tree.walk(nil, func(n, workspace *ipcNode) {
+		w := Window{ID: n.ID, Desktop: -1, Name: n.Name}
+		if w.Name == "" && n.AppID != nil {
+			w.Name = *n.AppID
+		}
+		if workspace != nil && !n.Sticky {
+			w.Desktop = workspace.desktop()
+		}
+		n.setAppInfo(&w)
+		n.setGeometry(&w)
+		if workspace != nil {
+			w.Monitor = workspace.Output
+		}
+		if w.IsSystem() {
+			return
+		}
+		snap.Windows = append(snap.Windows, &w)
+		if n.Focused {
+			snap.Active = w.ID
+		}
+		if n.Visible != nil && *n.Visible {
+			snap.Visible = append(snap.Visible, w.ID)
+		}
+	})
+	return &snap
+}
@@ -0,0 +1,73 @@
+package thyme
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSwayTracker(t *testing.T) {
+	t.Setenv("SWAYSOCK", startIPCServer(t, map[uint32]string{
+		ipcGetTree:       filepath.Join("testdata", "sway", "tree.json"),
+		ipcGetWorkspaces: filepath.Join("testdata", "sway", "workspaces.json"),
+	}))
+	snap, err := NewSwayTracker().Snap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Window{
+		// The scratchpad is a workspace of its own, without a number,
+		// so it is identified by its node ID.
+		{ID: 20, Desktop: 2147483647, Name: "Passwords - KeePassXC", Class: "org.keepassxc.KeePassXC", PID: 2020, Geometry: &Rect{0, 0, 800, 600}},
+		{ID: 11, Desktop: 1, Name: "~/src/thyme", Class: "foot", PID: 1111, Monitor: "eDP-1", Geometry: &Rect{0, 0, 960, 1080}},
+		{ID: 12, Desktop: 1, Name: "Mozilla Firefox", Class: "firefox", Instance: "Navigator", Role: "browser", PID: 1212, Monitor: "eDP-1", Geometry: &Rect{960, 0, 960, 1080}},
+		{ID: 13, Desktop: 1, Name: "Volume Control", Class: "org.pulseaudio.pavucontrol", PID: 1313, Monitor: "eDP-1", Geometry: &Rect{660, 340, 600, 400}},
+		{ID: 15, Desktop: 2, Name: "Inbox - Mail", Class: "thunderbird", PID: 1515, Monitor: "eDP-1", Geometry: &Rect{0, 25, 1920, 1055}},
+		// Windows without a title are named after their app_id.
+		{ID: 16, Desktop: 2, Name: "imv", Class: "imv", PID: 1616, Monitor: "eDP-1", Geometry: &Rect{0, 25, 1920, 1055}},
+		// Named workspaces without a number are identified by their
+		// node ID too.
+		{ID: 17, Desktop: 7, Name: "#thyme | Slack", Class: "Slack", PID: 1717, Monitor: "HDMI-A-1", Geometry: &Rect{1920, 0, 1920, 1080}},
+		{ID: 19, Desktop: 7, Name: "YouTube", Class: "mpv", PID: 1919, Monitor: "HDMI-A-1", Geometry: &Rect{1920, 0, 1920, 1080}, Fullscreen: true},
+		{ID: 18, Desktop: -1, Name: "Picture-in-Picture", Class: "firefox", PID: 1818, Monitor: "HDMI-A-1", Geometry: &Rect{3440, 780, 400, 300}},
+	}
+	if !reflect.DeepEqual(withoutExe(snap.Windows), want) {
+		t.Errorf("got windows\n%s\nwant\n%s", windowsString(snap.Windows), windowsString(want))
+	}
+	if snap.Active != 11 {
+		t.Errorf("got active window %d, want 11", snap.Active)
+	}
+	if want := []int64{11, 12, 13, 19}; !reflect.DeepEqual(snap.Visible, want) {
+		t.Errorf("got visible windows %v, want %v", snap.Visible, want)
+	}
+	if snap.CurrentDesktop == nil || *snap.CurrentDesktop != 1 {
+		t.Errorf("got current desktop %v, want 1", snap.CurrentDesktop)
+	}
+	if want := []*Desktop{{ID: 1, Name: "1"}, {ID: 2, Name: "2: web"}, {ID: 7, Name: "chat"}}; !reflect.DeepEqual(snap.Desktops, want) {
+		t.Errorf("got desktops %+v, want %+v", snap.Desktops, want)
+	}
+
+	// The floating volume control covers 300x400 of each of the tiled
+	// windows.
+	if got, want := snap.VisibleFraction[11], 1-float64(300*400)/(960*1080); got != want {
+		t.Errorf("got visible fraction %v for the terminal, want %v", got, want)
+	}
+	if got, want := snap.VisibleFraction[12], 1-float64(300*400)/(960*1080); got != want {
+		t.Errorf("got visible fraction %v for firefox, want %v", got, want)
+	}
+	if got := snap.VisibleFraction[13]; got != 1 {
+		t.Errorf("got visible fraction %v for the volume control, want 1", got)
+	}
+	if got := snap.VisibleFraction[19]; got != 1 {
+		t.Errorf("got visible fraction %v for the fullscreen video, want 1", got)
+	}
+}
+
+func TestSwayTrackerNoSocket(t *testing.T) {
+	t.Setenv("SWAYSOCK", filepath.Join(t.TempDir(), "missing.sock"))
+	if _, err := NewSwayTracker().Snap(context.Background()); err == nil {
+		t.Error("got no error without a sway IPC socket")
+	}
+}
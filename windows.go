@@ -3,6 +3,7 @@
 package thyme
 
 import (
+	"context"
 	"fmt"
 	"syscall"
 	"time"
@@ -40,10 +41,20 @@ var (
 	procGetWindowThreadProcessId = user.NewProc("GetWindowThreadProcessId")
 )
 
+// Capabilities reports no idle support because the WindowsTracker
+// doesn't query how long the user has been idle.
+func (t *WindowsTracker) Capabilities() Capabilities {
+	return Capabilities{Visibility: true}
+}
+
 func (t *WindowsTracker) Deps() string {
 	return "Nothing, Ready to Go!"
 }
 
+func (t *WindowsTracker) CheckDeps() []*Dependency {
+	return nil
+}
+
 // getWindowTitle returns a title of a window of the provided system window handle
 func getWindowTitle(window uintptr) string {
 	textLength, _, _ := procGetWindowTextLengthW.Call(uintptr(window))
@@ -74,7 +85,7 @@ func windowsIgnore(title string) bool {
 	return false
 }
 
-func (t *WindowsTracker) Snap() (snap *Snapshot, err error) {
+func (t *WindowsTracker) Snap(ctx context.Context) (snap *Snapshot, err error) {
 	var allWindows []*Window
 	var visible []int64
 	var active int64
@@ -89,6 +100,10 @@ func (t *WindowsTracker) Snap() (snap *Snapshot, err error) {
 			err = fmt.Errorf("lparam does not match what callback expected; received (%d), expected (%d)", lparam, cbId)
 			return 0
 		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			return 0 // stop enumeration
+		}
 		b, _, _ := procIsWindow.Call(uintptr(hwnd))
 		if b != 0 {
 			currentTitle := getWindowTitle(uintptr(hwnd))
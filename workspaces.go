@@ -0,0 +1,148 @@
+package thyme
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// WorkspaceTime is the time spent on each desktop (or workspace),
+// according to Snapshot.CurrentDesktop. Desktops are identified by
+// name (see Snapshot.DesktopName), so that desktops with the same name
+// add up even if their IDs change.
+type WorkspaceTime struct {
+	// Time maps each desktop name to the time spent on it. Each
+	// snapshot accounts for the time until the next one, up to
+	// MaxSampleTime.
+	Time map[string]time.Duration
+
+	// Samples maps each desktop name to the number of snapshots
+	// taken while it was current.
+	Samples map[string]int
+
+	// MaxSampleTime is the most time a single snapshot accounts for.
+	// Any time beyond it until the next snapshot (e.g., while the
+	// computer was asleep or Thyme wasn't running) counts as "No
+	// data" instead. It is zero if there is no limit.
+	MaxSampleTime time.Duration
+}
+
+// NewWorkspaceTime returns the WorkspaceTime of the snapshots in
+// stream. Like in NewTimeline, time the user spent away (see
+// Snapshot.IsAway) counts towards "Away", and gap markers (see
+// Snapshot.IsGap) towards "No data". Snapshots that don't record the
+// current desktop are left out. It returns nil if none of the
+// snapshots record it.
+func NewWorkspaceTime(stream *Stream, idleThreshold time.Duration) *WorkspaceTime {
+	wt := &WorkspaceTime{
+		Time:    make(map[string]time.Duration),
+		Samples: make(map[string]int),
+		// Leave room for jitter and slow snapshots.
+		MaxSampleTime: 2 * samplingInterval(stream),
+	}
+	var recorded bool
+	for i, snap := range stream.Snapshots {
+		var label string
+		if snap.IsGap() {
+			label = gapLabel
+		} else if snap.CurrentDesktop == nil {
+			continue
+		} else if snap.IsAway(idleThreshold) {
+			label, recorded = awayLabel, true
+		} else {
+			label, recorded = snap.DesktopName(*snap.CurrentDesktop), true
+		}
+		wt.Samples[label]++
+		if i+1 < len(stream.Snapshots) {
+			d := stream.Snapshots[i+1].Time.Sub(snap.Time)
+			if wt.MaxSampleTime > 0 && d > wt.MaxSampleTime {
+				wt.Time[gapLabel] += d - wt.MaxSampleTime
+				d = wt.MaxSampleTime
+			}
+			wt.Time[label] += d
+		}
+	}
+	if !recorded {
+		return nil
+	}
+	return wt
+}
+
+// samplingInterval returns the typical time between consecutive
+// snapshots in stream (the median), or zero if there are fewer than
+// two snapshots. The interval isn't recorded with the data, and may
+// have changed over time.
+func samplingInterval(stream *Stream) time.Duration {
+	var intervals []time.Duration
+	for i := 1; i < len(stream.Snapshots); i++ {
+		if d := stream.Snapshots[i].Time.Sub(stream.Snapshots[i-1].Time); d > 0 {
+			intervals = append(intervals, d)
+		}
+	}
+	if len(intervals) == 0 {
+		return 0
+	}
+	sort.Slice(intervals, func(a, b int) bool { return intervals[a] < intervals[b] })
+	return intervals[len(intervals)/2]
+}
+
+// Labels returns the desktop names in wt by decreasing time spent.
+func (wt *WorkspaceTime) Labels() []string {
+	var labels []string
+	for label := range wt.Time {
+		labels = append(labels, label)
+	}
+	// Time beyond MaxSampleTime counts as "No data" without a
+	// sample, and the last snapshot counts as a sample without time.
+	for label := range wt.Samples {
+		if _, ok := wt.Time[label]; !ok {
+			labels = append(labels, label)
+		}
+	}
+	sort.Slice(labels, func(a, b int) bool {
+		if wt.Time[labels[a]] != wt.Time[labels[b]] {
+			return wt.Time[labels[a]] > wt.Time[labels[b]]
+		}
+		return labels[a] < labels[b]
+	})
+	return labels
+}
+
+// Chart returns a bar chart of the time spent on each desktop, in
+// minutes. Time without data isn't shown, like in NewAggTime.
+func (wt *WorkspaceTime) Chart() *BarChart {
+	n := strconv.Itoa(maxNumberOfBars)
+	chart := NewBarChart("Workspace", "Workspace", "Minutes", "Top "+n+" workspaces by time")
+	for label, d := range wt.Time {
+		if label != gapLabel {
+			chart.Plus(label, d.Minutes())
+		}
+	}
+	return chart
+}
+
+// Workspaces prints a report of the time spent on each desktop (or
+// workspace) to stdout.
+func Workspaces(stream *Stream, idleThreshold time.Duration) error {
+	wt := NewWorkspaceTime(stream, idleThreshold)
+	if wt == nil {
+		return fmt.Errorf("the tracker that recorded this data doesn't record the current workspace")
+	}
+	var total time.Duration
+	for _, d := range wt.Time {
+		total += d
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Workspace\tTime\tShare\tSamples\n")
+	for _, label := range wt.Labels() {
+		var share float64
+		if total > 0 {
+			share = 100 * float64(wt.Time[label]) / float64(total)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.1f%%\t%d\n", label, wt.Time[label].Round(time.Second), share, wt.Samples[label])
+	}
+	return w.Flush()
+}
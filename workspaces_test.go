@@ -0,0 +1,101 @@
+package thyme
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewWorkspaceTime(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	desktops := []*Desktop{{ID: 0, Name: "Code"}, {ID: 1, Name: "Mail"}}
+	snap := func(at time.Duration, desktop int64) *Snapshot {
+		return &Snapshot{Time: start.Add(at), Desktops: desktops, CurrentDesktop: &desktop}
+	}
+	away := snap(7290*time.Second, 0)
+	away.Idle = 10 * time.Minute
+	stream := &Stream{Snapshots: []*Snapshot{
+		snap(0, 0),
+		snap(30*time.Second, 0),
+		snap(60*time.Second, 1),
+		// The computer was asleep for two hours after this one.
+		snap(90*time.Second, 1),
+		away,
+		{Time: start.Add(7320 * time.Second), Gap: "timed out"},
+		// A tracker that doesn't record the current desktop.
+		{Time: start.Add(7350 * time.Second)},
+		snap(7380*time.Second, 0),
+	}}
+
+	wt := NewWorkspaceTime(stream, 5*time.Minute)
+	if wt == nil {
+		t.Fatal("got nil")
+	}
+	if wt.MaxSampleTime != time.Minute {
+		t.Errorf("got max sample time %s, want 1m", wt.MaxSampleTime)
+	}
+	wantTime := map[string]time.Duration{
+		"Code": time.Minute,
+		// The snapshot before the computer went to sleep only
+		// counts for up to a minute...
+		"Mail": 90 * time.Second,
+		// ...and the rest counts as no data, along with the gap.
+		gapLabel:  2*time.Hour - time.Minute + 30*time.Second,
+		awayLabel: 30 * time.Second,
+	}
+	if !reflect.DeepEqual(wt.Time, wantTime) {
+		t.Errorf("got time %v, want %v", wt.Time, wantTime)
+	}
+	wantSamples := map[string]int{"Code": 3, "Mail": 2, awayLabel: 1, gapLabel: 1}
+	if !reflect.DeepEqual(wt.Samples, wantSamples) {
+		t.Errorf("got samples %v, want %v", wt.Samples, wantSamples)
+	}
+	if want := []string{gapLabel, "Mail", "Code", awayLabel}; !reflect.DeepEqual(wt.Labels(), want) {
+		t.Errorf("got labels %q, want %q", wt.Labels(), want)
+	}
+
+	chart := wt.Chart()
+	if want := map[string]float64{"Code": 1, "Mail": 1.5, awayLabel: 0.5}; !reflect.DeepEqual(chart.Series, want) {
+		t.Errorf("got chart series %v, want %v", chart.Series, want)
+	}
+	if chart.YLabel != "Minutes" {
+		t.Errorf("got chart y label %q, want %q", chart.YLabel, "Minutes")
+	}
+}
+
+func TestNewWorkspaceTimeNotRecorded(t *testing.T) {
+	stream := &Stream{Snapshots: []*Snapshot{
+		{Time: time.Unix(0, 0)},
+		{Time: time.Unix(30, 0), Gap: "timed out"},
+		{Time: time.Unix(60, 0)},
+	}}
+	if wt := NewWorkspaceTime(stream, 0); wt != nil {
+		t.Errorf("got %+v, want nil", wt)
+	}
+}
+
+func TestSamplingInterval(t *testing.T) {
+	stream := func(seconds ...int64) *Stream {
+		var s Stream
+		for _, sec := range seconds {
+			s.Snapshots = append(s.Snapshots, &Snapshot{Time: time.Unix(sec, 0)})
+		}
+		return &s
+	}
+	tests := []struct {
+		stream *Stream
+		want   time.Duration
+	}{
+		{stream: stream(), want: 0},
+		{stream: stream(100), want: 0},
+		{stream: stream(100, 100), want: 0},
+		{stream: stream(0, 30, 60, 3600, 3630), want: 30 * time.Second},
+		// The interval was changed from 30s to 10s.
+		{stream: stream(0, 30, 60, 70, 80, 90, 100), want: 10 * time.Second},
+	}
+	for i, test := range tests {
+		if got := samplingInterval(test.stream); got != test.want {
+			t.Errorf("%d: got %s, want %s", i, got, test.want)
+		}
+	}
+}
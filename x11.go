@@ -0,0 +1,457 @@
+package thyme
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/randr"
+	"github.com/BurntSushi/xgb/screensaver"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+func init() {
+	RegisterTracker("x11", NewX11Tracker)
+}
+
+// X11Tracker tracks application usage on X11 by talking the X protocol directly. It reads the window list, the active
+// window, and desktop membership from the EWMH properties the window manager maintains on the root window, so it
+// works with any EWMH-compliant window manager and needs no external programs. A single X connection is kept open
+// across snapshots.
+type X11Tracker struct {
+	c *x11Conn
+}
+
+// x11Conn is an X connection along with the information about the
+// X server that the X11Tracker looks up when it connects.
+type x11Conn struct {
+	conn   *xgb.Conn
+	root   xproto.Window
+	width  int
+	height int
+	atoms  map[string]xproto.Atom
+
+	// hasScreensaver is true if the X server supports the
+	// MIT-SCREEN-SAVER extension, which reports idle time.
+	hasScreensaver bool
+
+	// hasRandr is true if the X server supports the RandR extension,
+	// which reports the geometry of each monitor.
+	hasRandr bool
+}
+
+var _ Tracker = (*X11Tracker)(nil)
+
+func NewX11Tracker() Tracker {
+	return &X11Tracker{}
+}
+
+// Capabilities reports idle support without connecting to the X server
+// to check for the MIT-SCREEN-SAVER extension, which nearly all X
+// servers have. Without it, Snapshot.Idle is always zero.
+func (t *X11Tracker) Capabilities() Capabilities {
+	return Capabilities{Visibility: true, Idle: true}
+}
+
+func (t *X11Tracker) Deps() string {
+	return `
+No external programs are required, but the DISPLAY environment variable must point to a running X server with an
+EWMH-compliant window manager (nearly all modern window managers are).
+
+Note: this command prints out this message regardless of whether the dependencies are already installed. Run
+"thyme dep --check" to check which ones are.
+`
+}
+
+func (t *X11Tracker) CheckDeps() []*Dependency {
+	return []*Dependency{
+		checkProbe("X11 session", requireX11, nil),
+		checkProbe("X server connection", t.connect, nil),
+	}
+}
+
+func (t *X11Tracker) Probe() error {
+	if err := requireX11(); err != nil {
+		return err
+	}
+	return t.connect()
+}
+
+// x11AtomNames are the atoms the X11Tracker interns when it connects.
+var x11AtomNames = []string{
+	"_NET_CLIENT_LIST",
+	"_NET_CLIENT_LIST_STACKING",
+	"_NET_ACTIVE_WINDOW",
+	"_NET_WM_DESKTOP",
+	"_NET_CURRENT_DESKTOP",
+	"_NET_NUMBER_OF_DESKTOPS",
+	"_NET_DESKTOP_NAMES",
+	"_NET_WM_NAME",
+	"_NET_WM_PID",
+	"_NET_WM_STATE",
+	"_NET_WM_STATE_FULLSCREEN",
+	"_NET_WM_STATE_MAXIMIZED_VERT",
+	"_NET_WM_STATE_MAXIMIZED_HORZ",
+	"_NET_WM_STATE_HIDDEN",
+	"WM_WINDOW_ROLE",
+	"UTF8_STRING",
+}
+
+// connect opens the X connection if it isn't already open.
+func (t *X11Tracker) connect() error {
+	if t.c != nil {
+		return nil
+	}
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return fmt.Errorf("could not connect to the X server: %s. Check that DISPLAY is set.", err)
+	}
+
+	cookies := make([]xproto.InternAtomCookie, len(x11AtomNames))
+	for i, name := range x11AtomNames {
+		cookies[i] = xproto.InternAtom(conn, false, uint16(len(name)), name)
+	}
+	atoms := make(map[string]xproto.Atom, len(x11AtomNames))
+	for i, name := range x11AtomNames {
+		reply, err := cookies[i].Reply()
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("could not intern atom %s: %s", name, err)
+		}
+		atoms[name] = reply.Atom
+	}
+
+	screen := xproto.Setup(conn).DefaultScreen(conn)
+	t.c = &x11Conn{
+		conn:           conn,
+		root:           screen.Root,
+		width:          int(screen.WidthInPixels),
+		height:         int(screen.HeightInPixels),
+		atoms:          atoms,
+		hasScreensaver: screensaver.Init(conn) == nil,
+		hasRandr:       randr.Init(conn) == nil,
+	}
+	return nil
+}
+
+// disconnect closes the X connection, so that the next snapshot
+// reconnects.
+func (t *X11Tracker) disconnect() {
+	if t.c != nil {
+		t.c.conn.Close()
+		t.c = nil
+	}
+}
+
+func (t *X11Tracker) Snap(ctx context.Context) (*Snapshot, error) {
+	if err := t.connect(); err != nil {
+		return nil, err
+	}
+
+	// Requests to the X server can't be cancelled, so wait for the
+	// replies in the background.
+	type result struct {
+		snap *Snapshot
+		err  error
+	}
+	xc := t.c
+	done := make(chan result, 1)
+	go func() {
+		snap, err := xc.snap()
+		done <- result{snap, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			// The connection may be broken (e.g., the X server
+			// restarted), so start over with a new one next time.
+			t.disconnect()
+			return nil, r.err
+		}
+		return r.snap, nil
+	case <-ctx.Done():
+		// Abandon the connection, closing it once the requests in
+		// flight are done with it, and start over with a new one
+		// next time.
+		t.c = nil
+		go func() {
+			<-done
+			xc.conn.Close()
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func (xc *x11Conn) snap() (*Snapshot, error) {
+	clients, err := xc.getProp32(xc.root, "_NET_CLIENT_LIST")
+	if err != nil {
+		return nil, err
+	}
+	stacking, err := xc.getProp32(xc.root, "_NET_CLIENT_LIST_STACKING")
+	if err != nil {
+		return nil, err
+	}
+	var currentDesktop int64
+	if vals, err := xc.getProp32(xc.root, "_NET_CURRENT_DESKTOP"); err != nil {
+		return nil, err
+	} else if len(vals) > 0 {
+		currentDesktop = int64(vals[0])
+	}
+	desktops, err := xc.desktops()
+	if err != nil {
+		return nil, err
+	}
+	var active int64
+	if vals, err := xc.getProp32(xc.root, "_NET_ACTIVE_WINDOW"); err != nil {
+		return nil, err
+	} else if len(vals) > 0 {
+		active = int64(vals[0])
+	}
+
+	// Send every request for every window before waiting on any of
+	// the replies, so the whole snapshot costs about one round trip.
+	type windowCookies struct {
+		name, wmName, desktop   xproto.GetPropertyCookie
+		pid, class, role, state xproto.GetPropertyCookie
+		geometry                xproto.GetGeometryCookie
+		translate               xproto.TranslateCoordinatesCookie
+	}
+	cookies := make([]windowCookies, len(clients))
+	for i, c := range clients {
+		win := xproto.Window(c)
+		cookies[i] = windowCookies{
+			name:      xproto.GetProperty(xc.conn, false, win, xc.atoms["_NET_WM_NAME"], xc.atoms["UTF8_STRING"], 0, 1<<16),
+			wmName:    xproto.GetProperty(xc.conn, false, win, xproto.AtomWmName, xproto.AtomAny, 0, 1<<16),
+			desktop:   xproto.GetProperty(xc.conn, false, win, xc.atoms["_NET_WM_DESKTOP"], xproto.AtomCardinal, 0, 1),
+			pid:       xproto.GetProperty(xc.conn, false, win, xc.atoms["_NET_WM_PID"], xproto.AtomCardinal, 0, 1),
+			class:     xproto.GetProperty(xc.conn, false, win, xproto.AtomWmClass, xproto.AtomString, 0, 1<<16),
+			role:      xproto.GetProperty(xc.conn, false, win, xc.atoms["WM_WINDOW_ROLE"], xproto.AtomString, 0, 1<<16),
+			state:     xproto.GetProperty(xc.conn, false, win, xc.atoms["_NET_WM_STATE"], xproto.AtomAtom, 0, 1<<16),
+			geometry:  xproto.GetGeometry(xc.conn, xproto.Drawable(win)),
+			translate: xproto.TranslateCoordinates(xc.conn, win, xc.root, 0, 0),
+		}
+	}
+	var idleCookie screensaver.QueryInfoCookie
+	if xc.hasScreensaver {
+		idleCookie = screensaver.QueryInfo(xc.conn, xproto.Drawable(xc.root))
+	}
+
+	// A window can be destroyed after _NET_CLIENT_LIST is read, in
+	// which case the X server answers requests about it with a
+	// BadWindow (or BadDrawable) error. Such windows are left out of
+	// the snapshot with a warning instead of failing the whole
+	// snapshot.
+	var windows []*Window
+	var warnings []string
+	for i, c := range clients {
+		name, err := cookies[i].name.Reply()
+		wmName, err2 := cookies[i].wmName.Reply()
+		desktop, err3 := cookies[i].desktop.Reply()
+		geom, err4 := cookies[i].geometry.Reply()
+		pos, err5 := cookies[i].translate.Reply()
+		pid, err6 := cookies[i].pid.Reply()
+		class, err7 := cookies[i].class.Reply()
+		role, err8 := cookies[i].role.Reply()
+		state, err9 := cookies[i].state.Reply()
+		if err := firstError(err, err2, err3, err4, err5, err6, err7, err8, err9); err != nil {
+			if !isBadWindow(err) {
+				return nil, fmt.Errorf("could not get properties of window %d: %s", c, err)
+			}
+			warnings = append(warnings, fmt.Sprintf("left out window %d: %s", c, err))
+			continue
+		}
+
+		w := Window{ID: int64(c), Desktop: x11Desktop(desktop), Name: string(name.Value), Role: string(role.Value)}
+		if w.Name == "" {
+			// Fall back to the ICCCM name for windows that don't
+			// set the EWMH one.
+			w.Name = string(wmName.Value)
+		}
+		w.Instance, w.Class = x11Class(class)
+		w.Geometry = &Rect{X: int(pos.DstX), Y: int(pos.DstY), Width: int(geom.Width), Height: int(geom.Height)}
+		w.Fullscreen, w.Maximized, w.Minimized = netWMState(xc.atomNames(state))
+		if pid.Format == 32 && pid.ValueLen > 0 {
+			w.PID = int64(xgb.Get32(pid.Value))
+			w.Exe = processExe(w.PID)
+		}
+		if w.IsSystem() {
+			continue
+		}
+		windows = append(windows, &w)
+	}
+
+	var idle time.Duration
+	if xc.hasScreensaver {
+		info, err := idleCookie.Reply()
+		if err != nil {
+			return nil, fmt.Errorf("could not query idle time: %s", err)
+		}
+		idle = time.Duration(info.MsSinceUserInput) * time.Millisecond
+	}
+
+	monitors, err := xc.monitors()
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{
+		Windows:        windows,
+		Active:         active,
+		Idle:           idle,
+		Desktops:       desktops,
+		CurrentDesktop: &currentDesktop,
+		Warnings:       warnings,
+		Time:           time.Now(),
+	}
+	placeWindows(snap, monitors, currentDesktop)
+	stackingIDs := make([]int64, len(stacking))
+	for i, id := range stacking {
+		stackingIDs[i] = int64(id)
+	}
+	setVisibleFractions(snap, stackingIDs)
+	return snap, nil
+}
+
+// desktops returns the desktops, named after _NET_DESKTOP_NAMES. Window
+// managers may name fewer desktops than there are, in which case the
+// rest are left unnamed.
+func (xc *x11Conn) desktops() ([]*Desktop, error) {
+	vals, err := xc.getProp32(xc.root, "_NET_NUMBER_OF_DESKTOPS")
+	if err != nil || len(vals) == 0 {
+		return nil, err
+	}
+	reply, err := xproto.GetProperty(xc.conn, false, xc.root, xc.atoms["_NET_DESKTOP_NAMES"], xc.atoms["UTF8_STRING"], 0, 1<<16).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("could not get property _NET_DESKTOP_NAMES: %s", err)
+	}
+	names := strings.Split(string(reply.Value), "\x00")
+	desktops := make([]*Desktop, vals[0])
+	for i := range desktops {
+		desktops[i] = &Desktop{ID: int64(i)}
+		if i < len(names) {
+			desktops[i].Name = names[i]
+		}
+	}
+	return desktops, nil
+}
+
+// monitors returns the active monitors reported by RandR, or the
+// whole screen as a single unnamed monitor if RandR is unavailable.
+func (xc *x11Conn) monitors() ([]*Monitor, error) {
+	screen := []*Monitor{{Geometry: Rect{Width: xc.width, Height: xc.height}}}
+	if !xc.hasRandr {
+		return screen, nil
+	}
+
+	res, err := randr.GetScreenResourcesCurrent(xc.conn, xc.root).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("could not query RandR screen resources: %s", err)
+	}
+	var monitors []*Monitor
+	for _, output := range res.Outputs {
+		info, err := randr.GetOutputInfo(xc.conn, output, res.ConfigTimestamp).Reply()
+		if err != nil {
+			return nil, fmt.Errorf("could not query RandR output: %s", err)
+		}
+		if info.Connection != randr.ConnectionConnected || info.Crtc == 0 {
+			continue
+		}
+		crtc, err := randr.GetCrtcInfo(xc.conn, info.Crtc, res.ConfigTimestamp).Reply()
+		if err != nil {
+			return nil, fmt.Errorf("could not query RandR CRTC: %s", err)
+		}
+		monitors = append(monitors, &Monitor{
+			Name:     string(info.Name),
+			Geometry: Rect{X: int(crtc.X), Y: int(crtc.Y), Width: int(crtc.Width), Height: int(crtc.Height)},
+		})
+	}
+	if len(monitors) == 0 {
+		return screen, nil
+	}
+	return monitors, nil
+}
+
+// firstError returns the first non-nil error in errs.
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isBadWindow returns true if err is the error the X server returns
+// for requests about a window that no longer exists.
+func isBadWindow(err error) bool {
+	switch err.(type) {
+	case xproto.WindowError, xproto.DrawableError:
+		return true
+	}
+	return false
+}
+
+// getProp32 returns the value of a property of win that consists of
+// a list of 32-bit values (e.g., CARDINAL or WINDOW).
+func (xc *x11Conn) getProp32(win xproto.Window, name string) ([]uint32, error) {
+	reply, err := xproto.GetProperty(xc.conn, false, win, xc.atoms[name], xproto.AtomAny, 0, 1<<16).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("could not get property %s: %s", name, err)
+	}
+	if reply.Format != 32 {
+		return nil, nil
+	}
+	vals := make([]uint32, reply.ValueLen)
+	for i := range vals {
+		vals[i] = xgb.Get32(reply.Value[i*4:])
+	}
+	return vals, nil
+}
+
+// atomNames returns the names of the interned atoms in a property
+// that consists of a list of atoms. Other atoms are left out.
+func (xc *x11Conn) atomNames(reply *xproto.GetPropertyReply) []string {
+	if reply.Format != 32 {
+		return nil
+	}
+	var names []string
+	for i := 0; i < int(reply.ValueLen); i++ {
+		atom := xproto.Atom(xgb.Get32(reply.Value[i*4:]))
+		for name, a := range xc.atoms {
+			if a == atom {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// x11Class splits a WM_CLASS property into its instance and class,
+// which are stored as consecutive null-terminated strings.
+func x11Class(reply *xproto.GetPropertyReply) (instance, class string) {
+	parts := strings.Split(string(reply.Value), "\x00")
+	if len(parts) > 0 {
+		instance = parts[0]
+	}
+	if len(parts) > 1 {
+		class = parts[1]
+	}
+	return instance, class
+}
+
+// x11Desktop converts a _NET_WM_DESKTOP property to a Window.Desktop.
+// A window without the property (e.g., one the window manager
+// hasn't managed yet) is on an unknown desktop, not a sticky one.
+func x11Desktop(reply *xproto.GetPropertyReply) int64 {
+	if reply.Format != 32 || reply.ValueLen < 1 {
+		return UnknownDesktop
+	}
+	d := xgb.Get32(reply.Value)
+	if d == 0xFFFFFFFF {
+		// Sticky windows are on all desktops.
+		return -1
+	}
+	return int64(d)
+}
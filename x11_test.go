@@ -0,0 +1,193 @@
+package thyme
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// startXvfb starts an Xvfb server with a 1280x1024 screen for the
+// duration of the test and points DISPLAY at it. The test is skipped
+// if Xvfb isn't installed.
+func startXvfb(t *testing.T) {
+	path, err := exec.LookPath("Xvfb")
+	if err != nil {
+		t.Skip("Xvfb is not installed")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// Xvfb picks a free display and writes its number to -displayfd.
+	cmd := exec.Command(path, "-displayfd", "3", "-screen", "0", "1280x1024x24", "-nolisten", "tcp")
+	cmd.ExtraFiles = []*os.File{w}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	display, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil {
+		t.Fatalf("could not read display number from Xvfb: %s", err)
+	}
+	t.Setenv("DISPLAY", ":"+strings.TrimSpace(display))
+}
+
+// fakeWM sets the EWMH properties a window manager would maintain,
+// since Xvfb doesn't run one.
+type fakeWM struct {
+	t    *testing.T
+	conn *xgb.Conn
+	root xproto.Window
+}
+
+func (wm *fakeWM) atom(name string) xproto.Atom {
+	reply, err := xproto.InternAtom(wm.conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		wm.t.Fatal(err)
+	}
+	return reply.Atom
+}
+
+func (wm *fakeWM) setProp(win xproto.Window, prop, typ string, format byte, data []byte) {
+	n := uint32(len(data)) / uint32(format/8)
+	if err := xproto.ChangePropertyChecked(wm.conn, xproto.PropModeReplace, win, wm.atom(prop), wm.atom(typ), format, n, data).Check(); err != nil {
+		wm.t.Fatalf("could not set %s: %s", prop, err)
+	}
+}
+
+func (wm *fakeWM) setProp32(win xproto.Window, prop, typ string, vals ...uint32) {
+	data := make([]byte, 4*len(vals))
+	for i, v := range vals {
+		xgb.Put32(data[4*i:], v)
+	}
+	wm.setProp(win, prop, typ, 32, data)
+}
+
+func (wm *fakeWM) setAtoms(win xproto.Window, prop string, names ...string) {
+	vals := make([]uint32, len(names))
+	for i, name := range names {
+		vals[i] = uint32(wm.atom(name))
+	}
+	wm.setProp32(win, prop, "ATOM", vals...)
+}
+
+// window creates and maps a client window with the specified title
+// and geometry, on the specified desktops (none means the window
+// doesn't have a _NET_WM_DESKTOP property).
+func (wm *fakeWM) window(title string, x, y, width, height int, desktop ...uint32) xproto.Window {
+	win, err := xproto.NewWindowId(wm.conn)
+	if err != nil {
+		wm.t.Fatal(err)
+	}
+	if err := xproto.CreateWindowChecked(wm.conn, 0, win, wm.root, int16(x), int16(y), uint16(width), uint16(height), 0, xproto.WindowClassInputOutput, 0, 0, nil).Check(); err != nil {
+		wm.t.Fatal(err)
+	}
+	wm.setProp(win, "_NET_WM_NAME", "UTF8_STRING", 8, []byte(title))
+	if len(desktop) > 0 {
+		wm.setProp32(win, "_NET_WM_DESKTOP", "CARDINAL", desktop...)
+	}
+	if err := xproto.MapWindowChecked(wm.conn, win).Check(); err != nil {
+		wm.t.Fatal(err)
+	}
+	return win
+}
+
+func TestX11TrackerXvfb(t *testing.T) {
+	startXvfb(t)
+	conn, err := xgb.NewConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	wm := &fakeWM{t: t, conn: conn, root: xproto.Setup(conn).DefaultScreen(conn).Root}
+
+	editor := wm.window("main.go - Editor", 0, 0, 800, 600, 0)
+	term := wm.window("~  —  bash", 400, 300, 400, 300, 0)
+	mail := wm.window("Inbox", 0, 0, 1280, 1024, 1)
+	clock := wm.window("xclock", 1100, 900, 100, 100, 0xFFFFFFFF)
+	// A window the window manager hasn't placed on a desktop yet.
+	splash := wm.window("Splash", 0, 0, 300, 200)
+
+	wm.setProp(editor, "WM_CLASS", "STRING", 8, []byte("code\x00Code\x00"))
+	wm.setProp(editor, "WM_WINDOW_ROLE", "STRING", 8, []byte("editor"))
+	wm.setProp32(editor, "_NET_WM_PID", "CARDINAL", 4242)
+	wm.setAtoms(editor, "_NET_WM_STATE", "_NET_WM_STATE_MAXIMIZED_VERT", "_NET_WM_STATE_MAXIMIZED_HORZ")
+	wm.setAtoms(mail, "_NET_WM_STATE", "_NET_WM_STATE_FULLSCREEN")
+
+	wm.setProp32(wm.root, "_NET_CLIENT_LIST", "WINDOW", uint32(editor), uint32(term), uint32(mail), uint32(clock), uint32(splash))
+	wm.setProp32(wm.root, "_NET_CLIENT_LIST_STACKING", "WINDOW", uint32(mail), uint32(editor), uint32(splash), uint32(clock), uint32(term))
+	wm.setProp32(wm.root, "_NET_ACTIVE_WINDOW", "WINDOW", uint32(term))
+	wm.setProp32(wm.root, "_NET_CURRENT_DESKTOP", "CARDINAL", 0)
+	// The window manager only names the first of three desktops.
+	wm.setProp32(wm.root, "_NET_NUMBER_OF_DESKTOPS", "CARDINAL", 3)
+	wm.setProp(wm.root, "_NET_DESKTOP_NAMES", "UTF8_STRING", 8, []byte("review\x00"))
+
+	snap, err := NewX11Tracker().Snap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Window{
+		{ID: int64(editor), Desktop: 0, Name: "main.go - Editor", Class: "Code", Instance: "code", Role: "editor", PID: 4242, Geometry: &Rect{0, 0, 800, 600}, Maximized: true},
+		{ID: int64(term), Desktop: 0, Name: "~  —  bash", Geometry: &Rect{400, 300, 400, 300}},
+		{ID: int64(mail), Desktop: 1, Name: "Inbox", Geometry: &Rect{0, 0, 1280, 1024}, Fullscreen: true},
+		{ID: int64(clock), Desktop: -1, Name: "xclock", Geometry: &Rect{1100, 900, 100, 100}},
+		{ID: int64(splash), Desktop: UnknownDesktop, Name: "Splash", Geometry: &Rect{0, 0, 300, 200}},
+	}
+	if !reflect.DeepEqual(withoutExe(snap.Windows), want) {
+		t.Errorf("got windows\n%s\nwant\n%s", windowsString(snap.Windows), windowsString(want))
+	}
+	if snap.Active != int64(term) {
+		t.Errorf("got active window %d, want %d", snap.Active, term)
+	}
+	if want := []int64{int64(editor), int64(term), int64(clock)}; !reflect.DeepEqual(snap.Visible, want) {
+		t.Errorf("got visible windows %v, want %v", snap.Visible, want)
+	}
+	if snap.CurrentDesktop == nil || *snap.CurrentDesktop != 0 {
+		t.Errorf("got current desktop %v, want 0", snap.CurrentDesktop)
+	}
+	if want := []*Desktop{{ID: 0, Name: "review"}, {ID: 1}, {ID: 2}}; !reflect.DeepEqual(snap.Desktops, want) {
+		t.Errorf("got desktops %+v, want %+v", snap.Desktops, want)
+	}
+	// The terminal covers a quarter of the editor.
+	if got, want := snap.VisibleFraction[int64(editor)], 0.75; got != want {
+		t.Errorf("got visible fraction %v for the editor, want %v", got, want)
+	}
+}
+
+func TestX11Desktop(t *testing.T) {
+	prop := func(vals ...uint32) *xproto.GetPropertyReply {
+		data := make([]byte, 4*len(vals))
+		for i, v := range vals {
+			xgb.Put32(data[4*i:], v)
+		}
+		return &xproto.GetPropertyReply{Format: 32, ValueLen: uint32(len(vals)), Value: data}
+	}
+	tests := []struct {
+		name  string
+		reply *xproto.GetPropertyReply
+		want  int64
+	}{
+		{"desktop", prop(2), 2},
+		{"sticky", prop(0xFFFFFFFF), -1},
+		{"missing", &xproto.GetPropertyReply{}, UnknownDesktop},
+		{"empty", prop(), UnknownDesktop},
+	}
+	for _, test := range tests {
+		if got := x11Desktop(test.reply); got != test.want {
+			t.Errorf("%s: got desktop %d, want %d", test.name, got, test.want)
+		}
+	}
+}